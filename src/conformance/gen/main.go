@@ -0,0 +1,13 @@
+// Command gen (re)generates conformance/testdata/vectors from this
+// repo's own blockchain logic, by calling chain.DumpVectors directly now
+// that calculateHash, SignTransaction, validateBlock and
+// GetDynamicDifficulty all live in the importable pkg/chain package.
+package main
+
+import (
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
+)
+
+func main() {
+	chain.DumpVectors()
+}
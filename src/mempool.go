@@ -0,0 +1,409 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
+	"github.com/tosterlolz/Owonero/src/pkg/p2p"
+)
+
+// PendingTx wraps a pending transaction with the bookkeeping Bitcoin-family
+// mempools expose: when it was first seen and how many times (and when) it
+// has been rebroadcast to peers, so a stuck transaction can be inspected
+// and nudged without resubmitting it from scratch.
+type PendingTx struct {
+	Tx         chain.Transaction `json:"tx"`
+	FirstSeen  time.Time         `json:"first_seen"`
+	InvSentCnt int               `json:"inv_sent_cnt"`
+	SentCnt    int               `json:"sent_cnt"`
+	LastSent   time.Time         `json:"last_sent,omitempty"`
+}
+
+// Mempool holds pending, signature-verified, not-yet-mined transactions.
+// The whole pool is persisted to a single JSON file (path) after every
+// mutation, so a restarted daemon doesn't lose its backlog, and entries
+// are evicted by lowest fee (then oldest) once cap is reached, or once
+// they're older than mempoolExpiry.
+type Mempool struct {
+	mu    sync.Mutex
+	path  string
+	cap   int
+	txs   map[string]*PendingTx
+	order []string // insertion order, oldest first; tracks eviction age
+	seen  map[string]bool
+}
+
+// maxBlockTxs caps how many pending transactions a miner pulls into a
+// block alongside the coinbase.
+const maxBlockTxs = 500
+
+const defaultMempoolCap = 5000
+
+// mempoolExpiry evicts a pending transaction nobody has rebroadcast or
+// mined in this long, same rationale as Bitcoin Core's default 2-week
+// mempool expiry but scaled down for a chain with a much shorter block time.
+const mempoolExpiry = 72 * time.Hour
+
+func newMempool(path string) *Mempool {
+	mp := &Mempool{
+		path: path,
+		cap:  defaultMempoolCap,
+		txs:  make(map[string]*PendingTx),
+		seen: make(map[string]bool),
+	}
+	mp.loadFromDisk()
+	return mp
+}
+
+// txID keys a transaction by sha256(from|outputs|signature), so the
+// same signed transaction gossiped twice collapses to one entry.
+func txID(tx chain.Transaction) string {
+	return chain.TxID(tx)
+}
+
+// loadFromDisk re-populates the pool from path on startup.
+func (mp *Mempool) loadFromDisk() {
+	data, err := os.ReadFile(mp.path)
+	if err != nil {
+		return // no cache yet, nothing to load
+	}
+	var entries map[string]*PendingTx
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return
+	}
+	mp.txs = entries
+	ids := make([]string, 0, len(entries))
+	for id := range entries {
+		ids = append(ids, id)
+		mp.seen[id] = true
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return entries[ids[i]].FirstSeen.Before(entries[ids[j]].FirstSeen)
+	})
+	mp.order = ids
+}
+
+// persistAll writes the whole pool to mp.path in one shot. Called after
+// every mutation; caller must hold mp.mu.
+func (mp *Mempool) persistAll() {
+	data, err := json.MarshalIndent(mp.txs, "", "  ")
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(mp.path, data, 0644)
+}
+
+// lastNonce returns the highest nonce already used by sender, across the
+// confirmed chain (via bc.LastNonce's O(1) index lookup, instead of
+// rescanning bc.Chain here) and whatever is already pending in the pool.
+// Caller must hold mp.mu.
+func (mp *Mempool) lastNonce(sender string, bc *chain.Blockchain) int64 {
+	last := bc.LastNonce(sender)
+	for _, p := range mp.txs {
+		if p.Tx.From == sender && p.Tx.Nonce > last {
+			last = p.Tx.Nonce
+		}
+	}
+	return last
+}
+
+// Insert verifies tx's signature, rejects a double-spend against the tip's
+// balance (chain plus whatever else is already pending) and a replayed or
+// stale nonce, then caches it to disk and evicts if the pool is over cap.
+// bc is still needed for the nonce-replay check (idx doesn't track nonces).
+// hidx records tx as pending so gethistory can show it before it's mined.
+func (mp *Mempool) Insert(tx chain.Transaction, bc *chain.Blockchain, idx *chain.BalanceIndex, hidx *chain.HistoryIndex) error {
+	if !chain.VerifyTransactionSignature(&tx) {
+		return fmt.Errorf("invalid transaction signature")
+	}
+
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	id := txID(tx)
+	if _, exists := mp.txs[id]; exists {
+		return nil // already have it, not an error
+	}
+	if mp.seen[id] {
+		return nil // previously evicted or rejected; don't re-process
+	}
+
+	if tx.Nonce <= mp.lastNonce(tx.From, bc) {
+		return fmt.Errorf("replayed or stale nonce %d for %s", tx.Nonce, tx.From)
+	}
+
+	balance := getBalanceWithMempoolLocked(tx.From, idx, mp)
+	if int64(balance) < int64(tx.TotalOut()+tx.Fee) {
+		return fmt.Errorf("insufficient balance: have %d, need %d", balance, tx.TotalOut()+tx.Fee)
+	}
+
+	mp.txs[id] = &PendingTx{Tx: tx, FirstSeen: time.Now()}
+	mp.order = append(mp.order, id)
+	mp.seen[id] = true
+	mp.evictLocked()
+	mp.persistAll()
+	if hidx != nil {
+		hidx.ApplyPending(tx)
+	}
+	return nil
+}
+
+// evictLocked drops the lowest-fee (then oldest) entries until the pool is
+// back under cap. Caller must hold mp.mu.
+func (mp *Mempool) evictLocked() {
+	if len(mp.order) <= mp.cap {
+		return
+	}
+	sort.SliceStable(mp.order, func(i, j int) bool {
+		return mp.txs[mp.order[i]].Tx.Fee < mp.txs[mp.order[j]].Tx.Fee
+	})
+	for len(mp.order) > mp.cap {
+		id := mp.order[0]
+		mp.order = mp.order[1:]
+		delete(mp.txs, id)
+	}
+}
+
+// EvictExpired drops entries older than mempoolExpiry, e.g. a transaction
+// nobody has rebroadcast or mined in days. Meant to be called periodically
+// from a ticker (see runDaemon).
+func (mp *Mempool) EvictExpired() {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	cutoff := time.Now().Add(-mempoolExpiry)
+	kept := mp.order[:0]
+	changed := false
+	for _, id := range mp.order {
+		if mp.txs[id].FirstSeen.Before(cutoff) {
+			delete(mp.txs, id)
+			changed = true
+			continue
+		}
+		kept = append(kept, id)
+	}
+	mp.order = kept
+	if changed {
+		mp.persistAll()
+	}
+}
+
+// Remove drops a confirmed (or administratively discarded) transaction
+// from the pool, e.g. once its block is mined.
+func (mp *Mempool) Remove(id string) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	if _, ok := mp.txs[id]; !ok {
+		return
+	}
+	delete(mp.txs, id)
+	for i, o := range mp.order {
+		if o == id {
+			mp.order = append(mp.order[:i], mp.order[i+1:]...)
+			break
+		}
+	}
+	mp.persistAll()
+}
+
+// txSize is a transaction's serialized size in bytes, the denominator for
+// fee-rate ordering. Transactions don't carry an explicit size field, so
+// this just measures what AddBlock will actually store.
+func txSize(tx chain.Transaction) int {
+	data, _ := json.Marshal(tx)
+	return len(data)
+}
+
+// SelectForBlock returns up to max pending transactions ordered for
+// inclusion in a block template: grouped by sender with each sender's
+// txs in ascending nonce order (so AddBlock's validateNonces never sees
+// a later nonce before an earlier one from the same sender), with groups
+// themselves ordered by aggregate fee rate (Fee/size, highest first) --
+// the same rationale as Bitcoin Core's sat/vByte block-template ordering,
+// adapted for an account model where a sender's txs can't be reordered
+// independently of each other.
+func (mp *Mempool) SelectForBlock(max int) []chain.Transaction {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	bySender := make(map[string][]chain.Transaction)
+	for _, p := range mp.txs {
+		bySender[p.Tx.From] = append(bySender[p.Tx.From], p.Tx)
+	}
+
+	type group struct {
+		txs     []chain.Transaction
+		feeRate float64
+	}
+	groups := make([]group, 0, len(bySender))
+	for _, txs := range bySender {
+		sort.Slice(txs, func(i, j int) bool { return txs[i].Nonce < txs[j].Nonce })
+		var fee, size int
+		for _, tx := range txs {
+			fee += tx.Fee
+			size += txSize(tx)
+		}
+		groups = append(groups, group{txs: txs, feeRate: float64(fee) / float64(size)})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].feeRate > groups[j].feeRate })
+
+	selected := make([]chain.Transaction, 0, len(mp.txs))
+	for _, g := range groups {
+		selected = append(selected, g.txs...)
+	}
+	if len(selected) > max {
+		selected = selected[:max]
+	}
+	return selected
+}
+
+// All returns every pending transaction, for the getmempool pull.
+func (mp *Mempool) All() []chain.Transaction {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	all := make([]chain.Transaction, 0, len(mp.txs))
+	for _, p := range mp.txs {
+		all = append(all, p.Tx)
+	}
+	return all
+}
+
+// RawMempoolEntry is what getrawmempool/getmempoolentry hand back: a
+// lightweight view pairing the txid with the bookkeeping Bitcoin-family
+// mempools track.
+type RawMempoolEntry struct {
+	TxID       string    `json:"txid"`
+	Fee        int       `json:"fee"`
+	FirstSeen  time.Time `json:"first_seen"`
+	InvSentCnt int       `json:"inv_sent_cnt"`
+	SentCnt    int       `json:"sent_cnt"`
+	LastSent   time.Time `json:"last_sent,omitempty"`
+}
+
+func rawMempoolEntry(id string, p *PendingTx) RawMempoolEntry {
+	return RawMempoolEntry{
+		TxID:       id,
+		Fee:        p.Tx.Fee,
+		FirstSeen:  p.FirstSeen,
+		InvSentCnt: p.InvSentCnt,
+		SentCnt:    p.SentCnt,
+		LastSent:   p.LastSent,
+	}
+}
+
+// RawMempool returns a getrawmempool-style entry per pending transaction,
+// oldest first.
+func (mp *Mempool) RawMempool() []RawMempoolEntry {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	entries := make([]RawMempoolEntry, 0, len(mp.order))
+	for _, id := range mp.order {
+		entries = append(entries, rawMempoolEntry(id, mp.txs[id]))
+	}
+	return entries
+}
+
+// Entry returns the getmempoolentry-style detail for one txid.
+func (mp *Mempool) Entry(id string) (RawMempoolEntry, bool) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	p, ok := mp.txs[id]
+	if !ok {
+		return RawMempoolEntry{}, false
+	}
+	return rawMempoolEntry(id, p), true
+}
+
+// RawTx returns the pending transaction itself for a txid, for the
+// getrawtx daemon command -- distinct from Entry, which returns bookkeeping
+// metadata rather than the transaction.
+func (mp *Mempool) RawTx(id string) (chain.Transaction, bool) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	p, ok := mp.txs[id]
+	if !ok {
+		return chain.Transaction{}, false
+	}
+	return p.Tx, true
+}
+
+// Resend re-broadcasts a pending transaction to every known peer and bumps
+// its rebroadcast counters, for an operator trying to unstick a
+// transaction peers seem to have dropped.
+func (mp *Mempool) Resend(id string, pm *p2p.PeerManager) (chain.Transaction, bool) {
+	mp.mu.Lock()
+	p, ok := mp.txs[id]
+	if !ok {
+		mp.mu.Unlock()
+		return chain.Transaction{}, false
+	}
+	p.SentCnt++
+	p.InvSentCnt++
+	p.LastSent = time.Now()
+	tx := p.Tx
+	mp.persistAll()
+	mp.mu.Unlock()
+
+	gossipTx(pm, tx, "")
+	return tx, true
+}
+
+// getBalanceWithMempool extends the balance index with a mempool overlay:
+// pending sends reduce the spendable balance and pending receives are not
+// counted as spendable yet, so a double-spend racing two pending txs is
+// rejected by the second Insert.
+func getBalanceWithMempool(address string, idx *chain.BalanceIndex, mp *Mempool) int {
+	if mp == nil {
+		return int(idx.Balance(address))
+	}
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return getBalanceWithMempoolLocked(address, idx, mp)
+}
+
+// getBalanceWithMempoolLocked is getBalanceWithMempool's body; callers that
+// already hold mp.mu (Insert) call this directly instead.
+func getBalanceWithMempoolLocked(address string, idx *chain.BalanceIndex, mp *Mempool) int {
+	balance := int(idx.Balance(address))
+	for _, p := range mp.txs {
+		received := false
+		for _, o := range p.Tx.Outputs {
+			if o.To == address {
+				received = true
+				break
+			}
+		}
+		if received {
+			continue // not spendable until confirmed
+		}
+		if p.Tx.From == address {
+			balance -= p.Tx.TotalOut() + p.Tx.Fee
+		}
+	}
+	return balance
+}
+
+// gossipTx pushes tx to every known peer except excludeAddr, using the
+// legacy line protocol's new "tx" message. Peers dedup via their own
+// mempool's seen-set, so a tx doesn't flood the network in a loop.
+func gossipTx(pm *p2p.PeerManager, tx chain.Transaction, excludeAddr string) {
+	data, err := json.Marshal(tx)
+	if err != nil {
+		return
+	}
+	for _, peer := range pm.GetPeers() {
+		if peer.Address == excludeAddr {
+			continue
+		}
+		conn, err := p2p.DialPeer(peer.Address)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(conn, "tx\n%s\n", data)
+		conn.Close()
+	}
+}
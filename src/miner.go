@@ -6,14 +6,18 @@ import (
 	"fmt"
 	"net"
 	"runtime"
-	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
+	"github.com/tosterlolz/Owonero/src/pkg/p2p"
+	"github.com/tosterlolz/Owonero/src/pkg/wallet"
 )
 
 // discoverPeers connects to a node and gets its peer list
 func discoverPeers(nodeAddr string) ([]string, error) {
-	conn, err := net.Dial("tcp", nodeAddr)
+	conn, err := p2p.DialPeer(nodeAddr)
 	if err != nil {
 		return nil, fmt.Errorf("cannot connect to node for peer discovery: %v", err)
 	}
@@ -34,146 +38,118 @@ func discoverPeers(nodeAddr string) ([]string, error) {
 	return peers, nil
 }
 
-// startMining kopie bloki i wysyła je do node
+// stratumJob is the miner-side view of a mining.notify payload.
+type stratumJob struct {
+	jobID       string
+	prevHash    string
+	index       int
+	extranonce1 string
+	difficulty  int
+}
+
+// startMining is now a Stratum v1 client: it subscribes/authorizes once,
+// then mines whatever job the daemon pushes via mining.notify and submits
+// accepted nonces with mining.submit. This replaces the old submitblock/
+// submitshare/getchain line dialogue, where the submitter and share
+// goroutines raced over one shared bufio.Reader.
 // blocksToMine == 0 -> mine forever
 func startMining(walletPath, nodeAddr string, blocksToMine, threads int, pool bool) error {
-	w, err := loadOrCreateWallet(walletPath)
+	w, err := wallet.LoadOrCreateWallet(walletPath)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Mining for wallet %s to node %s\n", w.Address, nodeAddr)
+	fmt.Printf("Mining for wallet %s via Stratum to %s\n", w.Address, nodeAddr)
 
-	// połącz z node
 	conn, err := net.Dial("tcp", nodeAddr)
 	if err != nil {
-		return fmt.Errorf("cannot connect to node: %v", err)
+		return fmt.Errorf("cannot connect to stratum server: %v", err)
 	}
 	defer conn.Close()
 
-	// consume possible greeting line from node (e.g. "owonero-daemon ...")
-	reader := bufio.NewReader(conn)
-	if line, err := reader.ReadString('\n'); err == nil {
-		_ = line // ignore greeting
+	var writeMu sync.Mutex
+	enc := json.NewEncoder(conn)
+	send := func(req StratumRequest) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return enc.Encode(req)
 	}
 
-	// pobierz ostatni blok node
-	fmt.Fprintf(conn, "getchain\n")
-	var chain Blockchain
-	if err := json.NewDecoder(reader).Decode(&chain); err != nil {
-		return fmt.Errorf("cannot read chain from node: %v", err)
+	scanner := bufio.NewScanner(conn)
+	readResponse := func() (StratumResponse, error) {
+		if !scanner.Scan() {
+			return StratumResponse{}, fmt.Errorf("connection closed: %v", scanner.Err())
+		}
+		var resp StratumResponse
+		if err := json.Unmarshal(scanner.Bytes(), &resp); err != nil {
+			return StratumResponse{}, err
+		}
+		return resp, nil
 	}
-	var lastBlock = chain.Chain[len(chain.Chain)-1]
 
-	// Now that we have the connection, tell the node about discovered peers
-	if peers, err := discoverPeers(nodeAddr); err == nil {
-		fmt.Printf("Discovered %d peers from node, sharing with node\n", len(peers))
-		for _, peer := range peers {
-			if peer != "" && peer != nodeAddr {
-				fmt.Fprintf(conn, "addpeer\n%s\n", peer)
-				resp, _ := reader.ReadString('\n')
-				_ = resp // ignore response
-			}
-		}
+	if err := send(StratumRequest{ID: 1, Method: "mining.subscribe"}); err != nil {
+		return fmt.Errorf("subscribe failed: %v", err)
+	}
+	subResp, err := readResponse()
+	if err != nil {
+		return fmt.Errorf("subscribe response failed: %v", err)
+	}
+	extranonce1, _ := firstString(subResp.Result)
+	if err := send(StratumRequest{ID: 2, Method: "mining.authorize", Params: []interface{}{w.Address}}); err != nil {
+		return fmt.Errorf("authorize failed: %v", err)
+	}
+	if _, err := readResponse(); err != nil {
+		return fmt.Errorf("authorize response failed: %v", err)
 	}
 
-	// shared state
 	var minedCount int64
 	var attempts int64
-	blockCh := make(chan Block, threads*2)
-	shareCh := make(chan struct {
-		Wallet   string
-		Nonce    int
-		Attempts int64
-		Block    Block
-	}, threads*2)
-	errCh := make(chan error, 1)
+	var currentJob atomic.Value // stratumJob
+	var currentDiff int32 = 1
 	done := make(chan struct{})
-	var atomicHeadHash atomic.Value
-	atomicHeadHash.Store(lastBlock.Hash)
-	var atomicHeadBlock atomic.Value
-	atomicHeadBlock.Store(lastBlock)
+	errCh := make(chan error, 1)
+
+	currentJob.Store(stratumJob{extranonce1: extranonce1, difficulty: 1})
 
-	// submitter: single goroutine that sends blocks to node and updates lastBlock
+	// reader goroutine: dispatches server-pushed mining.notify /
+	// mining.set_difficulty and mining.submit acknowledgements.
 	go func() {
-		for {
-			select {
-			case b := <-blockCh:
-				// Only submit if block is on top of current head
-				headHash := atomicHeadHash.Load().(string)
-				if b.PrevHash != headHash {
-					// stale block, skip submission
+		for scanner.Scan() {
+			var req StratumRequest
+			if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+				continue
+			}
+			switch req.Method {
+			case "mining.notify":
+				// [jobID, prevHash, height, merkleRoot, timestamp, bits, extranonce1, cleanJobs]
+				if len(req.Params) < 8 {
 					continue
 				}
-				fmt.Fprintf(conn, "submitblock\n")
-				blockJSON, _ := json.Marshal(b)
-				fmt.Fprintf(conn, "%s\n", blockJSON)
-
-				resp, rerr := reader.ReadString('\n')
-				if rerr != nil {
-					select {
-					case errCh <- fmt.Errorf("read response error: %v", rerr):
-					default:
-					}
-					close(done)
-					return
-				}
-				resp = strings.TrimSpace(resp)
-				if resp == "ok" {
-					fmt.Printf("\033[32mBlock accepted! Index=%d Hash=%s\033[0m\n", b.Index, b.Hash)
-					atomicHeadHash.Store(b.Hash)
-					atomicHeadBlock.Store(b)
-				} else {
-					if strings.HasPrefix(resp, "error: block invalid") {
-						fmt.Fprintf(conn, "getchain\n")
-						var ch Blockchain
-						if err := json.NewDecoder(reader).Decode(&ch); err != nil {
-							select {
-							case errCh <- fmt.Errorf("cannot refresh chain after rejection: %v", err):
-							default:
-							}
-							close(done)
-							return
-						}
-						if len(ch.Chain) > 0 {
-							atomicHeadHash.Store(ch.Chain[len(ch.Chain)-1].Hash)
-							atomicHeadBlock.Store(ch.Chain[len(ch.Chain)-1])
-						}
-						time.Sleep(200 * time.Millisecond)
-						continue
-					}
-					select {
-					case errCh <- fmt.Errorf("node rejected block: %s", resp):
-					default:
-					}
-					close(done)
-					return
+				jobID, _ := req.Params[0].(string)
+				prevHash, _ := req.Params[1].(string)
+				index, _ := req.Params[2].(float64)
+				diff, _ := req.Params[5].(float64)
+				currentJob.Store(stratumJob{
+					jobID:       jobID,
+					prevHash:    prevHash,
+					index:       int(index),
+					extranonce1: extranonce1,
+					difficulty:  int(diff),
+				})
+			case "mining.set_difficulty":
+				if len(req.Params) < 1 {
+					continue
 				}
-				atomic.AddInt64(&minedCount, 1)
-				if blocksToMine > 0 && atomic.LoadInt64(&minedCount) >= int64(blocksToMine) {
-					close(done)
-					return
+				if d, ok := req.Params[0].(float64); ok {
+					atomic.StoreInt32(&currentDiff, int32(d))
 				}
-			case <-done:
-				return
 			}
 		}
-	}()
-
-	// share submitter
-	go func() {
-		for {
-			select {
-			case s := <-shareCh:
-				fmt.Fprintf(conn, "submitshare\n")
-				shareJSON, _ := json.Marshal(s)
-				fmt.Fprintf(conn, "%s\n", shareJSON)
-				resp, _ := reader.ReadString('\n')
-				_ = resp
-			case <-done:
-				return
-			}
+		select {
+		case errCh <- fmt.Errorf("stratum connection closed: %v", scanner.Err()):
+		default:
 		}
+		close(done)
 	}()
 
 	// stats printer: show H/s (hash attempts per second), SOL/s (accepted blocks/sec), and average hashrate
@@ -243,55 +219,50 @@ func startMining(walletPath, nodeAddr string, blocksToMine, threads int, pool bo
 	}
 	for i := 0; i < numThreads; i++ {
 		go func(id int) {
+			lastJobID := ""
 			for {
 				if blocksToMine > 0 && atomic.LoadInt64(&minedCount) >= int64(blocksToMine) {
 					return
 				}
-
-				// Always use latest chain head for mining
-				prev := atomicHeadBlock.Load().(Block)
-
-				coinbase := Transaction{From: "coinbase", To: w.Address, Amount: 1}
-				dynDiff := chain.GetDynamicDifficulty()
-				if pool {
-					dynDiff -= 2
-					if dynDiff < 1 {
-						dynDiff = 1
-					}
-				}
-				newBlock := mineBlock(prev, []Transaction{coinbase}, dynDiff, &attempts)
-
-				// return if signalled to stop
 				select {
 				case <-done:
 					return
 				default:
 				}
 
-				// If chain head changed while mining, skip this stale result
-				headHash := atomicHeadHash.Load().(string)
-				if newBlock.PrevHash != headHash {
+				job := currentJob.Load().(stratumJob)
+				if job.jobID == "" {
+					time.Sleep(100 * time.Millisecond)
 					continue
 				}
+				shareDiff := int(atomic.LoadInt32(&currentDiff))
+				if shareDiff < 1 {
+					shareDiff = 1
+				}
 
-				if pool {
-					select {
-					case shareCh <- struct {
-						Wallet   string
-						Nonce    int
-						Attempts int64
-						Block    Block
-					}{w.Address, newBlock.Nonce, atomic.LoadInt64(&attempts), newBlock}:
-					default:
-					}
-				} else {
-					// try send, but don't block forever
+				prev := chain.Block{Index: job.index - 1, Hash: job.prevHash}
+				coinbase := chain.NewTransaction("coinbase", w.Address, 1)
+				share := chain.MineBlock(prev, []chain.Transaction{coinbase}, shareDiff, &attempts)
+
+				// If the daemon moved on to a new job while we were hashing,
+				// throw this share away instead of submitting stale work.
+				if cur := currentJob.Load().(stratumJob); cur.jobID != job.jobID {
+					continue
+				}
+				lastJobID = job.jobID
+
+				if err := send(StratumRequest{
+					Method: "mining.submit",
+					Params: []interface{}{job.jobID, share.Nonce, fmt.Sprintf("%08x", id)},
+				}); err != nil {
 					select {
-					case blockCh <- newBlock:
+					case errCh <- fmt.Errorf("submit failed: %v", err):
 					default:
-						time.Sleep(100 * time.Millisecond)
 					}
+					return
 				}
+				atomic.AddInt64(&minedCount, 1)
+				_ = lastJobID
 			}
 		}(i)
 	}
@@ -315,3 +286,14 @@ func startMining(walletPath, nodeAddr string, blocksToMine, threads int, pool bo
 	// infinite mode: block until an error is reported
 	return <-errCh
 }
+
+// firstString pulls params[0] out of a JSON-RPC result array, as returned
+// for mining.subscribe ([extranonce1]).
+func firstString(result interface{}) (string, bool) {
+	arr, ok := result.([]interface{})
+	if !ok || len(arr) == 0 {
+		return "", false
+	}
+	s, ok := arr[0].(string)
+	return s, ok
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
+	"github.com/tosterlolz/Owonero/src/pkg/p2p"
+	"github.com/tosterlolz/Owonero/src/pkg/protocol"
+)
+
+// Binary mining protocol for the pool daemon: a length-prefixed,
+// typed-message replacement for the line-based JSON text protocols
+// (handleConn's submitshare/submitblock/sendtx, and Stratum v1's
+// mining.submit) for miner traffic, where a framing byte and a job id are
+// cheaper than a newline-delimited JSON-RPC line per share and let the
+// daemon reject a share mined against an abandoned job instead of
+// re-deriving a fresh candidate from the current tip regardless of what
+// job the miner thought it was working on.
+
+// binaryMiningSession is per-connection state for a subscribed miner.
+type binaryMiningSession struct {
+	conn         net.Conn
+	sessionID    string
+	extranonce1  string
+	wallet       string
+	difficulty   int
+	currentJobID string
+	shareTimes   []time.Time // recent accept timestamps, used for vardiff
+}
+
+// BinaryMiningServer runs the binary protocol side of pool mining: it
+// tracks connected sessions, assigns extranonce1 values, runs vardiff,
+// and keeps its own PPLNS share ledger, independent from Stratum v1's so
+// the two protocols don't need to share a lock to stay correct.
+type BinaryMiningServer struct {
+	bc   *chain.Blockchain
+	pm   *p2p.PeerManager
+	port int
+	mp   *Mempool
+	idx  *chain.BalanceIndex
+	hidx *chain.HistoryIndex
+
+	mutex    sync.Mutex
+	sessions map[string]*binaryMiningSession
+	window   []pplnsShare // ring buffer, oldest first
+	jobSeq   int64
+	jobs     map[string]*miningJob
+}
+
+func newBinaryMiningServer(bc *chain.Blockchain, pm *p2p.PeerManager, port int, mp *Mempool, idx *chain.BalanceIndex, hidx *chain.HistoryIndex) *BinaryMiningServer {
+	return &BinaryMiningServer{
+		bc:       bc,
+		pm:       pm,
+		port:     port,
+		mp:       mp,
+		idx:      idx,
+		hidx:     hidx,
+		sessions: make(map[string]*binaryMiningSession),
+		jobs:     make(map[string]*miningJob),
+	}
+}
+
+// run starts the binary protocol listener and the job broadcaster. It
+// blocks, so callers should invoke it in a goroutine.
+func (s *BinaryMiningServer) run() {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		log.Fatalf("miningproto: failed to listen: %v", err)
+	}
+	defer ln.Close()
+	fmt.Printf("\033[32mBinary mining protocol listening on :%d\033[0m\n", s.port)
+
+	go s.broadcastJobsLoop()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Println("miningproto: accept error:", err)
+			continue
+		}
+		go s.handleSession(conn)
+	}
+}
+
+// broadcastJobsLoop pushes a NewJob with CleanJobs=true whenever the
+// chain head changes, so every connected session works on the current
+// tip -- the server-initiated push the line protocols can't do without
+// the client polling first.
+func (s *BinaryMiningServer) broadcastJobsLoop() {
+	lastHead := ""
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		if len(s.bc.Chain) == 0 {
+			continue
+		}
+		head := s.bc.Chain[len(s.bc.Chain)-1].Hash
+		if head == lastHead {
+			continue
+		}
+		lastHead = head
+		s.mutex.Lock()
+		for _, sess := range s.sessions {
+			s.sendJob(sess, true)
+		}
+		s.mutex.Unlock()
+	}
+}
+
+func (s *BinaryMiningServer) handleSession(conn net.Conn) {
+	defer conn.Close()
+
+	mType, body, err := protocol.ReadFrame(conn)
+	if err != nil {
+		return
+	}
+	if mType != protocol.MsgHello {
+		_ = protocol.WriteFrame(conn, protocol.MsgError, protocol.ErrorMsg{Error: "expected Hello as the first frame"})
+		return
+	}
+	var hello protocol.Hello
+	if err := json.Unmarshal(body, &hello); err != nil || hello.Version != protocol.Version {
+		_ = protocol.WriteFrame(conn, protocol.MsgError, protocol.ErrorMsg{Error: fmt.Sprintf("unsupported protocol version, daemon speaks %d", protocol.Version)})
+		return
+	}
+
+	sessionIDBytes := make([]byte, 8)
+	_, _ = rand.Read(sessionIDBytes)
+	extranonce1 := make([]byte, 4)
+	_, _ = rand.Read(extranonce1)
+
+	sess := &binaryMiningSession{
+		conn:        conn,
+		sessionID:   hex.EncodeToString(sessionIDBytes),
+		extranonce1: hex.EncodeToString(extranonce1),
+		difficulty:  1,
+	}
+	if err := protocol.WriteFrame(conn, protocol.MsgHelloAck, protocol.HelloAck{Version: protocol.Version, SessionID: sess.sessionID}); err != nil {
+		return
+	}
+
+	for {
+		mType, body, err := protocol.ReadFrame(conn)
+		if err != nil {
+			break
+		}
+		switch mType {
+		case protocol.MsgSubscribeMiner:
+			var req protocol.SubscribeMiner
+			_ = json.Unmarshal(body, &req)
+			sess.wallet = req.Wallet
+			s.mutex.Lock()
+			s.sessions[sess.sessionID] = sess
+			s.mutex.Unlock()
+			_ = protocol.WriteFrame(conn, protocol.MsgSubscribeAck, protocol.SubscribeAck{ExtraNonce1: sess.extranonce1, Difficulty: sess.difficulty})
+			s.sendJob(sess, true)
+
+		case protocol.MsgSubmitShare:
+			var req protocol.SubmitShare
+			_ = json.Unmarshal(body, &req)
+			result := s.acceptShare(sess, req)
+			_ = protocol.WriteFrame(conn, protocol.MsgShareResult, result)
+
+		case protocol.MsgSubmitBlock:
+			var req protocol.SubmitBlock
+			_ = json.Unmarshal(body, &req)
+			result := protocol.SubmitBlockResult{Accepted: true}
+			if !s.bc.AddBlock(req.Block, s.bc.GetDynamicDifficulty()) {
+				result = protocol.SubmitBlockResult{Accepted: false, Error: "block rejected"}
+			} else {
+				_ = s.bc.SaveToFile(blockchainFile)
+				s.idx.ApplyBlock(req.Block)
+				_ = s.idx.SaveToFile(utxoFile)
+				s.hidx.ApplyBlock(req.Block)
+				_ = s.hidx.SaveToFile(historyFile)
+				go gossipBlock(s.pm, req.Block.Hash, "")
+			}
+			_ = protocol.WriteFrame(conn, protocol.MsgSubmitBlockResult, result)
+
+		case protocol.MsgSendTx:
+			var req protocol.SendTx
+			_ = json.Unmarshal(body, &req)
+			result := protocol.SendTxResult{Accepted: true, TxID: txID(req.Tx)}
+			if err := s.mp.Insert(req.Tx, s.bc, s.idx, s.hidx); err != nil {
+				result = protocol.SendTxResult{Accepted: false, Error: err.Error()}
+			} else {
+				go gossipTx(s.pm, req.Tx, "")
+			}
+			_ = protocol.WriteFrame(conn, protocol.MsgSendTxResult, result)
+
+		case protocol.MsgGetChain:
+			_ = protocol.WriteFrame(conn, protocol.MsgChain, protocol.ChainMsg{Blocks: s.bc.Chain})
+
+		default:
+			_ = protocol.WriteFrame(conn, protocol.MsgError, protocol.ErrorMsg{Error: fmt.Sprintf("unknown message type %d", mType)})
+		}
+	}
+
+	s.mutex.Lock()
+	delete(s.sessions, sess.sessionID)
+	s.mutex.Unlock()
+}
+
+// sendJob builds the FINAL candidate block for this session -- PPLNS
+// payouts from the current window, a finder-fee coinbase for sess, and
+// pending mempool txs -- caches it under a fresh JobID (see miningJob in
+// stratum.go, shared by both protocols), and issues a NewJob. The miner
+// mines against exactly this transaction set, so a winning nonce's hash is
+// still valid once acceptShare reassembles the same candidate and hands it
+// to AddBlock; nothing about the block's content is decided after the
+// fact.
+func (s *BinaryMiningServer) sendJob(sess *binaryMiningSession, cleanJobs bool) {
+	s.jobSeq++
+	jobID := fmt.Sprintf("%d", s.jobSeq)
+	prev := s.bc.Chain[len(s.bc.Chain)-1]
+	bits := s.bc.GetDynamicDifficulty()
+
+	s.mutex.Lock()
+	payouts := pplnsPayouts(s.window, 100)
+	s.mutex.Unlock()
+
+	txs := make([]chain.Transaction, 0, len(payouts)+2)
+	for payee, amt := range payouts {
+		if amt > 0 {
+			txs = append(txs, chain.NewTransaction("coinbase", payee, amt))
+		}
+	}
+
+	var pending []chain.Transaction
+	if s.mp != nil {
+		pending = s.mp.SelectForBlock(maxBlockTxs)
+		var feeTotal int
+		for _, tx := range pending {
+			feeTotal += tx.Fee
+		}
+		if feeTotal > 0 {
+			txs = append(txs, chain.NewTransaction("coinbase", sess.wallet, feeTotal))
+		}
+	}
+	txs = append(txs, pending...)
+
+	candidate := chain.Block{
+		Index:        prev.Index + 1,
+		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+		Transactions: txs,
+		PrevHash:     prev.Hash,
+	}
+
+	s.mutex.Lock()
+	s.jobs[jobID] = &miningJob{block: candidate, bits: bits, createdAt: time.Now(), pending: pending}
+	s.pruneExpiredJobsLocked()
+	s.mutex.Unlock()
+	sess.currentJobID = jobID
+
+	_ = protocol.WriteFrame(sess.conn, protocol.MsgNewJob, protocol.NewJob{
+		JobID:       jobID,
+		PrevHash:    prev.Hash,
+		Height:      prev.Index + 1,
+		ExtraNonce1: sess.extranonce1,
+		Difficulty:  bits,
+		CleanJobs:   cleanJobs,
+	})
+}
+
+// pruneExpiredJobsLocked drops cached jobs older than jobExpiry. Caller
+// must hold s.mutex.
+func (s *BinaryMiningServer) pruneExpiredJobsLocked() {
+	for id, j := range s.jobs {
+		if time.Since(j.createdAt) > jobExpiry {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func (s *BinaryMiningServer) sendDifficulty(sess *binaryMiningSession) {
+	_ = protocol.WriteFrame(sess.conn, protocol.MsgSetDifficulty, protocol.SetDifficulty{Difficulty: sess.difficulty})
+}
+
+// acceptShare validates a SubmitShare against the cached job it claims to
+// solve (rejecting an unknown or expired JobID as stale before even
+// looking at the nonce), records it in the PPLNS window, runs vardiff,
+// and -- if the share also clears network difficulty -- commits the
+// job's already-finalized candidate, crediting the window.
+func (s *BinaryMiningServer) acceptShare(sess *binaryMiningSession, req protocol.SubmitShare) protocol.ShareResult {
+	if req.JobID != sess.currentJobID {
+		return protocol.ShareResult{Accepted: false, Stale: true, Error: "stale job id"}
+	}
+
+	s.mutex.Lock()
+	job, ok := s.jobs[req.JobID]
+	if ok && time.Since(job.createdAt) > jobExpiry {
+		delete(s.jobs, req.JobID)
+		ok = false
+	}
+	s.mutex.Unlock()
+	if !ok {
+		return protocol.ShareResult{Accepted: false, Stale: true, Error: "stale or unknown job id"}
+	}
+
+	candidate := job.block
+	candidate.Nonce = req.Nonce
+	candidate.Hash = chain.CalculateHash(candidate)
+
+	shareDiff := sess.difficulty
+	if !strings.HasPrefix(candidate.Hash, strings.Repeat("0", shareDiff)) {
+		return protocol.ShareResult{Accepted: false, Error: "low-difficulty share"}
+	}
+
+	s.mutex.Lock()
+	s.window = append(s.window, pplnsShare{Wallet: sess.wallet, Difficulty: shareDiff, Timestamp: time.Now()})
+	if len(s.window) > pplnsWindowSize {
+		s.window = s.window[len(s.window)-pplnsWindowSize:]
+	}
+	sess.shareTimes = append(sess.shareTimes, time.Now())
+	if len(sess.shareTimes) > 20 {
+		sess.shareTimes = sess.shareTimes[len(sess.shareTimes)-20:]
+	}
+	s.adjustVardiff(sess)
+	s.mutex.Unlock()
+
+	if strings.HasPrefix(candidate.Hash, strings.Repeat("0", job.bits)) {
+		s.finalizeBlock(candidate, job.bits, job.pending)
+	}
+
+	return protocol.ShareResult{Accepted: true}
+}
+
+// adjustVardiff retargets a session's share difficulty towards ~10
+// shares/sec based on the observed rate over its last recorded shares.
+// Caller must hold s.mutex.
+func (s *BinaryMiningServer) adjustVardiff(sess *binaryMiningSession) {
+	const targetSharesPerSec = 10.0
+	if len(sess.shareTimes) < 2 {
+		return
+	}
+	span := sess.shareTimes[len(sess.shareTimes)-1].Sub(sess.shareTimes[0]).Seconds()
+	if span <= 0 {
+		return
+	}
+	rate := float64(len(sess.shareTimes)-1) / span
+	switch {
+	case rate > targetSharesPerSec*1.5 && sess.difficulty < 7:
+		sess.difficulty++
+		s.sendDifficulty(sess)
+	case rate < targetSharesPerSec/1.5 && sess.difficulty > 1:
+		sess.difficulty--
+		s.sendDifficulty(sess)
+	}
+}
+
+// Stats reports the current pool state, mirroring StratumServer.Stats so
+// getpoolstats works the same regardless of which protocol a miner
+// connects with.
+func (s *BinaryMiningServer) Stats() PoolStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	wallets := make(map[string]bool)
+	var totalDiff int64
+	for _, sh := range s.window {
+		wallets[sh.Wallet] = true
+		totalDiff += int64(sh.Difficulty)
+	}
+	return PoolStats{
+		ConnectedWorkers: len(s.sessions),
+		WindowShares:     len(s.window),
+		WindowDifficulty: totalDiff,
+		DistinctMiners:   len(wallets),
+	}
+}
+
+// Payouts previews what each wallet would currently earn from a block
+// reward of reward, per the live PPLNS window.
+func (s *BinaryMiningServer) Payouts(reward int) map[string]int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return pplnsPayouts(s.window, reward)
+}
+
+// finalizeBlock commits a job's already-mined candidate. Its transactions
+// (PPLNS payouts, finder fee, pending mempool txs) were fixed back when
+// sendJob built the job, and candidate.Hash was computed over exactly that
+// set, so nothing here rebuilds or reorders them -- doing so would
+// invalidate the PoW the miner actually solved. Caller must NOT hold
+// s.mutex.
+func (s *BinaryMiningServer) finalizeBlock(candidate chain.Block, difficulty int, pending []chain.Transaction) {
+	if s.bc.AddBlock(candidate, difficulty) {
+		_ = s.bc.SaveToFile(blockchainFile)
+		s.idx.ApplyBlock(candidate)
+		_ = s.idx.SaveToFile(utxoFile)
+		s.hidx.ApplyBlock(candidate)
+		_ = s.hidx.SaveToFile(historyFile)
+		go gossipBlock(s.pm, candidate.Hash, "")
+		if s.mp != nil {
+			for _, tx := range pending {
+				s.mp.Remove(txID(tx))
+			}
+		}
+		s.mutex.Lock()
+		windowLen := len(s.window)
+		s.mutex.Unlock()
+		fmt.Printf("\033[32mBinary mining protocol: block %d found (PPLNS window=%d shares), included %d mempool txs\033[0m\n",
+			candidate.Index, windowLen, len(pending))
+	}
+}
@@ -0,0 +1,128 @@
+package chain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+// addressVersion is the single version byte prefixed onto every hashed
+// public key before base58 encoding, mirroring gocoin's btc.AddrVersion.
+const addressVersion = 0x1c
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// hash160 returns RIPEMD160(SHA256(data)), the same two-hash construction
+// gocoin's btc.Hash160 uses to compress a public key down to 20 bytes.
+func hash160(data []byte) []byte {
+	sh := sha256.Sum256(data)
+	r := ripemd160.New()
+	r.Write(sh[:])
+	return r.Sum(nil)
+}
+
+// doubleSha256 is the standard blockchain checksum hash.
+func doubleSha256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+func base58Encode(data []byte) string {
+	zeros := 0
+	for zeros < len(data) && data[zeros] == 0 {
+		zeros++
+	}
+	n := new(big.Int).SetBytes(data)
+	base := big.NewInt(58)
+	mod := new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, base, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for i := 0; i < zeros; i++ {
+		out = append(out, base58Alphabet[0])
+	}
+	// out was built least-significant-digit first; reverse it.
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	base := big.NewInt(58)
+	for _, c := range s {
+		idx := strings.IndexRune(base58Alphabet, c)
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		n.Mul(n, base)
+		n.Add(n, big.NewInt(int64(idx)))
+	}
+	decoded := n.Bytes()
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), decoded...), nil
+}
+
+// AddrFromPubKey derives the canonical OWO address for a PEM-encoded ECDSA
+// public key: "OWO" + base58(version || hash160(pubkey DER) || checksum4),
+// checksum being the first 4 bytes of doubleSha256(version || hash160).
+// This ties an address to the key that controls it, unlike the old
+// timestamp-derived address LoadOrCreateWallet used to mint.
+func AddrFromPubKey(pubPem string) (string, error) {
+	block, _ := pem.Decode([]byte(pubPem))
+	if block == nil {
+		return "", fmt.Errorf("cannot decode public key PEM")
+	}
+	payload := append([]byte{addressVersion}, hash160(block.Bytes)...)
+	checksum := doubleSha256(payload)[:4]
+	return "OWO" + base58Encode(append(payload, checksum...)), nil
+}
+
+// NewAddrFromString parses and checksum-validates an OWO address, returning
+// the HASH160 it encodes (mirroring gocoin's btc.NewAddrFromString).
+func NewAddrFromString(addr string) ([]byte, error) {
+	if !strings.HasPrefix(addr, "OWO") {
+		return nil, fmt.Errorf("not an OWO address: %s", addr)
+	}
+	raw, err := base58Decode(strings.TrimPrefix(addr, "OWO"))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 1+20+4 {
+		return nil, fmt.Errorf("malformed OWO address length")
+	}
+	payload, checksum := raw[:len(raw)-4], raw[len(raw)-4:]
+	if !bytes.Equal(checksum, doubleSha256(payload)[:4]) {
+		return nil, fmt.Errorf("bad OWO address checksum")
+	}
+	if payload[0] != addressVersion {
+		return nil, fmt.Errorf("unknown OWO address version %#x", payload[0])
+	}
+	return payload[1:], nil
+}
+
+// addrMatchesPubKey reports whether addr is the OWO address derived from
+// the given PEM-encoded public key's DER bytes.
+func addrMatchesPubKey(addr, pubPem string) bool {
+	want, err := NewAddrFromString(addr)
+	if err != nil {
+		return false
+	}
+	block, _ := pem.Decode([]byte(pubPem))
+	if block == nil {
+		return false
+	}
+	return bytes.Equal(want, hash160(block.Bytes))
+}
@@ -0,0 +1,888 @@
+// Package chain holds the block/transaction data model, validation rules
+// and proof-of-work: everything daemon, wallet and miner binaries need to
+// agree on without depending on each other's JSON-RPC or TUI code.
+package chain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+
+	"github.com/tosterlolz/Owonero/src/pkg/beacon"
+)
+
+// TxOutput is one recipient/amount pair within a Transaction's Outputs,
+// letting a single transaction pay several recipients in one shot
+// (mirroring gocoin's `-send addr1=amt1,addr2=amt2`).
+type TxOutput struct {
+	To     string `json:"to"`
+	Amount int    `json:"amount"`
+}
+
+// Transaction reprezentuje prostą transakcję
+type Transaction struct {
+	// From is the sender's OWO address. It's derived from PubKey (see
+	// AddrFromPubKey) rather than being the pubkey itself, so addresses stay
+	// short and checksummed instead of embedding a whole PEM blob.
+	From string `json:"from"`
+	// Outputs is always at least one entry; NewTransaction builds the
+	// common single-recipient case.
+	Outputs []TxOutput `json:"outputs"`
+	Fee     int        `json:"fee,omitempty"`
+	// Nonce must be strictly greater than any nonce From has used before,
+	// checked in validateBlock and the mempool, to stop a signed tx from
+	// being replayed onto the chain a second time.
+	Nonce int64 `json:"nonce,omitempty"`
+	// PubKey is the PEM-encoded public key authorizing this spend; omitted
+	// for coinbase transactions, which are never signature-checked.
+	// VerifyTransactionSignature requires HASH160(PubKey) to match From
+	// before it even looks at Signature, so a spender can't claim a From
+	// address their key doesn't control.
+	PubKey    string `json:"pubkey,omitempty"`
+	Signature string `json:"signature"`
+}
+
+// NewTransaction builds the common single-recipient Transaction, unsigned.
+func NewTransaction(from, to string, amount int) Transaction {
+	return Transaction{From: from, Outputs: []TxOutput{{To: to, Amount: amount}}}
+}
+
+// TotalOut sums every output's amount -- the spendable total this
+// transaction pays out, not counting Fee.
+func (tx Transaction) TotalOut() int {
+	total := 0
+	for _, o := range tx.Outputs {
+		total += o.Amount
+	}
+	return total
+}
+
+// outputsDigest renders Outputs into the deterministic, order-preserving
+// form SignTransaction/VerifyTransactionSignature hash, so a multi-output
+// transaction's recipients and amounts are as tamper-evident as From/Fee/
+// Nonce already were.
+func outputsDigest(outputs []TxOutput) string {
+	parts := make([]string, len(outputs))
+	for i, o := range outputs {
+		parts[i] = fmt.Sprintf("%s:%d", o.To, o.Amount)
+	}
+	return strings.Join(parts, ",")
+}
+
+// TxID returns tx's content-addressed id, sha256(From|OutputsJSON|Signature)
+// hex-encoded. It lives here rather than only in the daemon's mempool so
+// HistoryIndex can key entries by the same id the mempool, RPC and web
+// stats server already use to identify a transaction.
+func TxID(tx Transaction) string {
+	outputs, _ := json.Marshal(tx.Outputs)
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s", tx.From, outputs, tx.Signature)))
+	return hex.EncodeToString(h[:])
+}
+
+// MerkleRoot returns a deterministic digest of txs' ids, letting a pool
+// job commit to an exact transaction set (coinbase + selected mempool
+// txs) without shipping the full transactions to every miner -- a miner
+// reconstructing the candidate from a cached job template can use this to
+// confirm it was handed the same set the daemon will score the share
+// against.
+func MerkleRoot(txs []Transaction) string {
+	ids := make([]string, len(txs))
+	for i, tx := range txs {
+		ids[i] = TxID(tx)
+	}
+	h := sha256.Sum256([]byte(strings.Join(ids, "|")))
+	return hex.EncodeToString(h[:])
+}
+
+// Block struktura bloku
+type Block struct {
+	Index        int           `json:"index"`
+	Timestamp    string        `json:"timestamp"`
+	Transactions []Transaction `json:"transactions"`
+	PrevHash     string        `json:"prev_hash"`
+	Hash         string        `json:"hash"`
+	Nonce        int           `json:"nonce"`
+	// Uncles are valid successors of a recent ancestor that lost the race
+	// to extend the chain. A block may reference up to two, crediting
+	// their miners a share of the reward instead of discarding the work.
+	Uncles []Block `json:"uncles,omitempty"`
+	// Beacon is the randomness-beacon entry this block commits to, once a
+	// beacon.Network has activated (see beacon.ActiveAPI). It's a pointer so
+	// omitempty drops it entirely for blocks mined before activation,
+	// keeping their hashes unchanged.
+	Beacon *beacon.Entry `json:"beacon,omitempty"`
+	// Difficulty is the PoW difficulty this block was mined/accepted at.
+	// It isn't part of BlockForHash -- it's bookkeeping for
+	// GetDynamicDifficulty, not an input to the hash -- and
+	// AddBlockSkipPow always overwrites it with the difficulty the chain
+	// actually required, so a peer can't lie about how hard its blocks
+	// were to find.
+	Difficulty int `json:"difficulty,omitempty"`
+}
+
+// Blockchain - łańcuch bloków
+type Blockchain struct {
+	Chain []Block `json:"chain"`
+
+	// TargetBlockTime seconds GetDynamicDifficulty averages towards; 0
+	// falls back to defaultTargetBlockTime.
+	TargetBlockTime int `json:"-"`
+
+	// hashIndex maps a block hash to its position in Chain for O(1)
+	// block-locator lookups during sync (see BlockLocator/IndexOfHash).
+	// Unexported so it's never part of the JSON persisted by
+	// SaveToFile/LoadFromFile; it's rebuilt lazily whenever it's missing
+	// or has fallen out of sync with Chain's length.
+	hashIndex map[string]int
+
+	// nonceIndex maps a sender address to the highest nonce it has used in
+	// any confirmed transaction, so validateNonces/LastNonce don't rescan
+	// the whole chain on every block/tx. AddBlockSkipPow folds each newly
+	// appended block in directly (see foldNonces), so it stays exact
+	// through normal mining; nonceIndexTip lets ensureNonceIndex notice
+	// when Chain was instead mutated in place (reorg rollback, direct
+	// genesis append during sync) and fall back to a full rebuild.
+	nonceIndex    map[string]int64
+	nonceIndexTip int
+}
+
+// defaultTargetBlockTime is used by GetDynamicDifficulty when
+// Blockchain.TargetBlockTime hasn't been set by the caller.
+const defaultTargetBlockTime = 30
+
+// MinDifficulty is the difficulty floor GetDynamicDifficulty clamps to and
+// every block on the chain must meet, regardless of when it was mined --
+// unlike the current dynamic difficulty, it doesn't drift over time, so
+// it's safe to check a header against without knowing the chain's history
+// (see ValidHeaderChain).
+const MinDifficulty = 1
+
+// GetDynamicDifficulty adjusts mining difficulty towards TargetBlockTime
+// (or defaultTargetBlockTime if unset) based on the average time over the
+// last window blocks.
+func (bc *Blockchain) GetDynamicDifficulty() int {
+	targetBlockTime := bc.TargetBlockTime
+	if targetBlockTime == 0 {
+		targetBlockTime = defaultTargetBlockTime
+	}
+	minDifficulty := MinDifficulty
+	maxDifficulty := 7 // Lower max difficulty for easier mining
+	window := 10       // Number of blocks to average
+	if len(bc.Chain) <= window {
+		return minDifficulty
+	}
+	latest := bc.Chain[len(bc.Chain)-1]
+	prev := bc.Chain[len(bc.Chain)-window]
+	tLatest, _ := time.Parse(time.RFC3339, latest.Timestamp)
+	tPrev, _ := time.Parse(time.RFC3339, prev.Timestamp)
+	avgBlockTime := int(tLatest.Sub(tPrev).Seconds()) / window
+	diff := bc.Chain[len(bc.Chain)-1].Difficulty
+	if avgBlockTime < targetBlockTime {
+		diff++
+	} else if avgBlockTime > targetBlockTime {
+		diff--
+	}
+	if diff < minDifficulty {
+		diff = minDifficulty
+	}
+	if diff > maxDifficulty {
+		diff = maxDifficulty
+	}
+	return diff
+}
+
+// SignTransaction signs tx with an ECDSA private key in PEM form. Lives
+// here rather than pkg/wallet so conformance_gen.go/conformance_test.go
+// (which must stay inside this package to reach calculateHash/
+// validateBlock directly) can also exercise signing without an import
+// cycle; pkg/wallet calls this same function under its own name.
+func SignTransaction(tx *Transaction, privPem string) error {
+	privBlock, _ := pem.Decode([]byte(privPem))
+	if privBlock == nil {
+		return fmt.Errorf("nie można zdekodować klucza prywatnego")
+	}
+	priv, err := x509.ParseECPrivateKey(privBlock.Bytes)
+	if err != nil {
+		return fmt.Errorf("nie można sparsować klucza prywatnego: %v", err)
+	}
+	// Hashujemy dane transakcji
+	msg := fmt.Sprintf("%s|%s|%d|%d", tx.From, outputsDigest(tx.Outputs), tx.Fee, tx.Nonce)
+	hash := sha256.Sum256([]byte(msg))
+	r, s, err := ecdsa.Sign(crand.Reader, priv, hash[:])
+	if err != nil {
+		return fmt.Errorf("błąd podpisywania: %v", err)
+	}
+	sigBytes, _ := json.Marshal(struct {
+		R string `json:"r"`
+		S string `json:"s"`
+	}{R: r.Text(16), S: s.Text(16)})
+	tx.Signature = hex.EncodeToString(sigBytes)
+	return nil
+}
+
+// VerifyTransactionSignature verifies tx.Signature against tx.PubKey, but
+// only after checking that HASH160(tx.PubKey) actually matches tx.From --
+// otherwise a spender could sign validly with their own key while claiming
+// someone else's address as the sender.
+func VerifyTransactionSignature(tx *Transaction) bool {
+	if !addrMatchesPubKey(tx.From, tx.PubKey) {
+		return false
+	}
+	pubBlock, _ := pem.Decode([]byte(tx.PubKey))
+	if pubBlock == nil {
+		return false
+	}
+	pubAny, err := x509.ParsePKIXPublicKey(pubBlock.Bytes)
+	if err != nil {
+		return false
+	}
+	pub, ok := pubAny.(*ecdsa.PublicKey)
+	if !ok {
+		return false
+	}
+	msg := fmt.Sprintf("%s|%s|%d|%d", tx.From, outputsDigest(tx.Outputs), tx.Fee, tx.Nonce)
+	hash := sha256.Sum256([]byte(msg))
+	sigBytes, err := hex.DecodeString(tx.Signature)
+	if err != nil {
+		return false
+	}
+	var sig struct {
+		R string `json:"r"`
+		S string `json:"s"`
+	}
+	if err := json.Unmarshal(sigBytes, &sig); err != nil {
+		return false
+	}
+	r := new(big.Int)
+	s := new(big.Int)
+	r.SetString(sig.R, 16)
+	s.SetString(sig.S, 16)
+	return ecdsa.Verify(pub, hash[:], r, s)
+}
+
+// BlockForHash - struct for calculating hash without the hash field
+type BlockForHash struct {
+	Index        int           `json:"index"`
+	Timestamp    string        `json:"timestamp"`
+	Transactions []Transaction `json:"transactions"`
+	PrevHash     string        `json:"prev_hash"`
+	Nonce        int           `json:"nonce"`
+	Uncles       []Block       `json:"uncles,omitempty"`
+	Beacon       *beacon.Entry `json:"beacon,omitempty"`
+}
+
+// calculateHash hashes a block under whichever PoW scheme is active
+// (powMode, see dag.go): the epoch-based memory-hard DAG by default, or
+// the original rx/owo scratchpad when SetPowMode("rxowo-legacy") is set.
+func calculateHash(b Block) string {
+	if powMode == "rxowo-legacy" {
+		return calculateHashLegacy(b)
+	}
+	return calculateHashDAG(b)
+}
+
+// CalculateHash is calculateHash, exported for callers outside this
+// package that must hash a block they assembled themselves instead of
+// through MineBlock -- e.g. the pool daemon's Stratum server checking a
+// submitted share against its own reconstructed candidate block.
+func CalculateHash(b Block) string {
+	return calculateHash(b)
+}
+
+// calculateHashLegacy is the original rx/owo scratchpad PoW: a 1MB buffer
+// reseeded per block and touched at 8 predictable offsets. It's kept only
+// so blocks mined before the DAG switchover still validate.
+func calculateHashLegacy(b Block) string {
+	blockForHash := BlockForHash{
+		Index:        b.Index,
+		Timestamp:    b.Timestamp,
+		Transactions: b.Transactions,
+		PrevHash:     b.PrevHash,
+		Nonce:        b.Nonce,
+		Uncles:       b.Uncles,
+		Beacon:       b.Beacon,
+	}
+	blockBytes, _ := json.Marshal(blockForHash)
+	memSize := 1024 * 1024 // 1MB buffer, must match mineBlockLegacy
+	mem := make([]byte, memSize)
+	// Deterministic memory buffer: seed with block index and prev hash
+	seed := sha256.Sum256([]byte(fmt.Sprintf("%d%s", b.Index, b.PrevHash)))
+	for i := 0; i < memSize; i++ {
+		mem[i] = seed[i%len(seed)]
+	}
+	acc := uint64(b.Nonce)
+	for i := 0; i < 8; i++ {
+		idx := (b.Nonce*31 + i*7919) % memSize
+		acc ^= uint64(mem[idx]) << (i * 8)
+	}
+	puzzle := (b.Nonce ^ len(blockBytes)) + int(acc&0xFFFF)
+	hashInput := append(blockBytes, mem[(b.Nonce*13)%memSize])
+	hashInput = append(hashInput, byte(puzzle&0xFF))
+	for i := 0; i < 8; i++ {
+		hashInput = append(hashInput, byte((acc>>(i*8))&0xFF))
+	}
+	h := sha3.Sum256(hashInput)
+	return hex.EncodeToString(h[:])
+}
+
+// mineBlockLegacy - optimized rx/owo PoW: combines SHA3, random memory, and math puzzle
+func mineBlockLegacy(prev Block, txs []Transaction, difficulty int, attemptsPtr *int64, uncles ...Block) Block {
+	var b Block
+	nonce := 0
+	memSize := 1024 * 1024 // 1MB buffer for GPU mining
+	mem := make([]byte, memSize)
+
+	// Pre-calculate block data outside the loop
+	b.Index = prev.Index + 1
+	b.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	b.Transactions = txs
+	b.PrevHash = prev.Hash
+	b.Uncles = uncles
+	b.Beacon = nextBeaconEntry(prev, b.Index)
+
+	// Seed memory buffer once per block (optimized seeding)
+	seed := sha256.Sum256([]byte(fmt.Sprintf("%d%s", b.Index, b.PrevHash)))
+	// Fill memory in chunks for better performance
+	for i := 0; i < memSize; i += 32 {
+		end := i + 32
+		if end > memSize {
+			end = memSize
+		}
+		copy(mem[i:end], seed[:end-i])
+	}
+
+	// Pre-marshal block data (without nonce)
+	blockForHash := BlockForHash{
+		Index:        b.Index,
+		Timestamp:    b.Timestamp,
+		Transactions: b.Transactions,
+		PrevHash:     b.PrevHash,
+		Uncles:       b.Uncles,
+		Beacon:       b.Beacon,
+		// Nonce will be set per attempt
+	}
+	blockBytesBase, _ := json.Marshal(blockForHash)
+
+	// Pre-allocate hash input buffer to avoid repeated allocations
+	maxInputSize := len(blockBytesBase) + 1 + 8 + 1 // blockBytes + mem byte + puzzle byte + acc bytes
+	hashInput := make([]byte, 0, maxInputSize)
+
+	for {
+		b.Nonce = nonce
+
+		// Update blockForHash with current nonce
+		blockForHash.Nonce = nonce
+		blockBytes, _ := json.Marshal(blockForHash)
+
+		// rx/owo: optimized memory access pattern
+		acc := uint64(nonce)
+		// Pre-compute base index to reduce calculations
+		baseIdx := nonce * 31 % memSize
+		step := 7919 % memSize
+
+		for i := 0; i < 8; i++ {
+			idx := (baseIdx + i*step) % memSize
+			acc ^= uint64(mem[idx]) << (i * 8)
+		}
+		puzzle := (nonce ^ len(blockBytes)) + int(acc&0xFFFF)
+
+		// Build hash input efficiently
+		hashInput = hashInput[:0] // reset length, keep capacity
+		hashInput = append(hashInput, blockBytes...)
+		hashInput = append(hashInput, mem[(nonce*13)%memSize])
+		hashInput = append(hashInput, byte(puzzle&0xFF))
+		// Add acc as 8 bytes (more efficient than byte-by-byte)
+		hashInput = append(hashInput, byte(acc), byte(acc>>8), byte(acc>>16), byte(acc>>24),
+			byte(acc>>32), byte(acc>>40), byte(acc>>48), byte(acc>>56))
+
+		h := sha3.Sum256(hashInput)
+
+		if attemptsPtr != nil {
+			atomic.AddInt64(attemptsPtr, 1)
+		}
+
+		// Check if hash meets difficulty (check raw bytes for better performance)
+		valid := true
+		if difficulty > 0 {
+			// Check bytes directly (each byte represents 2 hex chars)
+			for i := 0; i < (difficulty+1)/2 && i < 32; i++ {
+				bb := h[i]
+				if difficulty > i*2 && bb>>4 != 0 { // Check high nibble
+					valid = false
+					break
+				}
+				if difficulty > i*2+1 && (bb&0x0F) != 0 { // Check low nibble
+					valid = false
+					break
+				}
+			}
+		}
+		if valid {
+			b.Hash = hex.EncodeToString(h[:])
+			break
+		}
+
+		nonce++
+	}
+	return b
+}
+
+// createGenesisBlock - genesis
+func createGenesisBlock() Block {
+	g := Block{
+		Index:        0,
+		Timestamp:    "2025-10-11T00:00:00Z", // Fixed timestamp for all nodes
+		Transactions: []Transaction{NewTransaction("genesis", "network", 0)},
+		PrevHash:     "",
+		Nonce:        0,
+	}
+	g.Hash = calculateHash(g)
+	return g
+}
+
+// blockReward is the base coinbase payout a solo-mined block earns, shared
+// between the main finder and any referenced uncles.
+const blockReward = 100
+
+// BuildCoinbaseWithUncles assembles the coinbase transaction set for a
+// block being mined on top of currentHeight+1: the main finder gets the
+// full reward, each included uncle's miner gets 7/8 of it scaled by how
+// stale the uncle is, and the including block earns a 1/32 fee on top for
+// doing the bookkeeping (P2Pool-style uncle accounting).
+func BuildCoinbaseWithUncles(minerAddr string, currentHeight int, uncles []Block) []Transaction {
+	txs := []Transaction{NewTransaction("coinbase", minerAddr, blockReward)}
+	if len(uncles) == 0 {
+		return txs
+	}
+	var uncleFees int
+	for _, uncle := range uncles {
+		if len(uncle.Transactions) == 0 {
+			continue
+		}
+		uncleMiner := uncle.Transactions[0].Outputs[0].To
+		depth := currentHeight + 1 - uncle.Index
+		scale := 8 - depth
+		if scale < 0 {
+			scale = 0
+		}
+		reward := blockReward * 7 / 8 * scale / 8
+		if reward > 0 {
+			txs = append(txs, NewTransaction("coinbase", uncleMiner, reward))
+			uncleFees += blockReward / 32
+		}
+	}
+	if uncleFees > 0 {
+		txs = append(txs, NewTransaction("coinbase", minerAddr, uncleFees))
+	}
+	return txs
+}
+
+// nextBeaconEntry fetches the beacon entry a block at height should commit
+// to, chaining from prev's own entry, or nil if no beacon.Network has
+// activated by height yet (leaving Beacon unset, same as every block mined
+// before this feature existed).
+func nextBeaconEntry(prev Block, height int) *beacon.Entry {
+	api := beacon.ActiveAPI(height)
+	if api == nil {
+		return nil
+	}
+	var prevEntry beacon.Entry
+	if prev.Beacon != nil {
+		prevEntry = *prev.Beacon
+	}
+	entry, err := api.Entry(context.Background(), uint64(height), prevEntry)
+	if err != nil {
+		return nil
+	}
+	return &entry
+}
+
+// MineBlock mines a block under whichever PoW scheme is active (see
+// SetPowMode/dag.go): the epoch-based memory-hard DAG by default, or the
+// original rx/owo scratchpad when "rxowo-legacy" is selected.
+func MineBlock(prev Block, txs []Transaction, difficulty int, attemptsPtr *int64, uncles ...Block) Block {
+	if powMode == "rxowo-legacy" {
+		return mineBlockLegacy(prev, txs, difficulty, attemptsPtr, uncles...)
+	}
+	return mineBlockDAG(prev, txs, difficulty, attemptsPtr, uncles...)
+}
+
+// validateBlock - sprawdza poprawność: prevHash, hash, index, PoW (rx/owo)
+func (bc *Blockchain) validateBlock(b Block, difficulty int, skipPow bool) bool {
+	if len(bc.Chain) == 0 {
+		// Genesis block validation
+		if b.Index != 0 {
+			fmt.Printf("Genesis block validation failed: Index must be 0, got %d\n", b.Index)
+			return false
+		}
+		if b.PrevHash != "" {
+			fmt.Printf("Genesis block validation failed: PrevHash must be empty, got %s\n", b.PrevHash)
+			return false
+		}
+		if calculateHash(b) != b.Hash {
+			fmt.Printf("Genesis block validation failed: Hash mismatch (calculated %s, stored %s)\n", calculateHash(b), b.Hash)
+			return false
+		}
+		return true
+	}
+
+	last := bc.Chain[len(bc.Chain)-1]
+	if b.PrevHash != last.Hash {
+		fmt.Printf("Block %d validation failed: PrevHash mismatch (expected %s, got %s)\n", b.Index, last.Hash, b.PrevHash)
+		return false
+	}
+	if calculateHash(b) != b.Hash {
+		fmt.Printf("Block %d validation failed: Hash mismatch (calculated %s, stored %s)\n", b.Index, calculateHash(b), b.Hash)
+		return false
+	}
+	if b.Index != last.Index+1 {
+		fmt.Printf("Block %d validation failed: Index mismatch (expected %d, got %d)\n", b.Index, last.Index+1, b.Index)
+		return false
+	}
+	if !skipPow {
+		// check PoW: hash must start with difficulty zeros (optimized check)
+		if difficulty > 0 && len(b.Hash) >= difficulty {
+			hashBytes := []byte(b.Hash)
+			validPow := true
+			for i := 0; i < (difficulty+1)/2 && i < len(hashBytes)/2; i++ {
+				if difficulty > i*2 && hashBytes[i*2] != '0' {
+					validPow = false
+					break
+				}
+				if difficulty > i*2+1 && hashBytes[i*2+1] != '0' {
+					validPow = false
+					break
+				}
+			}
+			if !validPow {
+				return false
+			}
+		}
+	}
+	if !bc.validateUncles(b, difficulty, skipPow) {
+		return false
+	}
+	if !bc.validateNonces(b) {
+		return false
+	}
+	if !bc.validateBeacon(b, last) {
+		return false
+	}
+	for _, tx := range b.Transactions {
+		if tx.Fee < 0 {
+			fmt.Printf("Block %d validation failed: tx from %s has negative fee\n", b.Index, tx.From)
+			return false
+		}
+		for _, o := range tx.Outputs {
+			if o.Amount < 0 {
+				fmt.Printf("Block %d validation failed: tx from %s to %s has negative amount\n", b.Index, tx.From, o.To)
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// validateBeacon enforces beacon.ActiveAPI(b.Index): once a network has
+// activated, b must carry an entry that verifiably chains from last's (or
+// from the zero entry, if last predates activation). Blocks mined before
+// activation are untouched, since ActiveAPI returns nil for them.
+func (bc *Blockchain) validateBeacon(b Block, last Block) bool {
+	api := beacon.ActiveAPI(b.Index)
+	if api == nil {
+		return true
+	}
+	if b.Beacon == nil {
+		fmt.Printf("Block %d validation failed: missing required beacon entry\n", b.Index)
+		return false
+	}
+	var prevEntry beacon.Entry
+	if last.Beacon != nil {
+		prevEntry = *last.Beacon
+	}
+	if err := api.VerifyEntry(prevEntry, *b.Beacon); err != nil {
+		fmt.Printf("Block %d validation failed: %v\n", b.Index, err)
+		return false
+	}
+	return true
+}
+
+// foldNonces folds one block's transactions into nonceIndex. Callers must
+// hold no lock (Blockchain isn't safe for concurrent mutation already).
+func (bc *Blockchain) foldNonces(b Block) {
+	for _, tx := range b.Transactions {
+		if tx.From == "coinbase" {
+			continue
+		}
+		if tx.Nonce > bc.nonceIndex[tx.From] {
+			bc.nonceIndex[tx.From] = tx.Nonce
+		}
+	}
+}
+
+// rebuildNonceIndex rebuilds the sender->last-nonce map from the current
+// Chain, same rationale as rebuildHashIndex.
+func (bc *Blockchain) rebuildNonceIndex() {
+	bc.nonceIndex = make(map[string]int64)
+	for _, blk := range bc.Chain {
+		bc.foldNonces(blk)
+	}
+	bc.nonceIndexTip = len(bc.Chain)
+}
+
+// ensureNonceIndex rebuilds nonceIndex if it's missing or Chain was mutated
+// in place since it was last folded (reorg rollback, or a block appended
+// directly instead of through AddBlock/AddBlockSkipPow).
+func (bc *Blockchain) ensureNonceIndex() {
+	if bc.nonceIndex == nil || bc.nonceIndexTip != len(bc.Chain) {
+		bc.rebuildNonceIndex()
+	}
+}
+
+// LastNonce returns the highest nonce sender has used in any confirmed
+// transaction, for callers (the mempool) that need to check a pending tx's
+// nonce against the chain without layering a full rescan on top of their
+// own pending-pool scan.
+func (bc *Blockchain) LastNonce(sender string) int64 {
+	bc.ensureNonceIndex()
+	return bc.nonceIndex[sender]
+}
+
+// validateNonces rejects a block that replays a sender's transaction at a
+// nonce already used in an earlier block, or reuses/lowers a nonce within
+// the block itself. Coinbase transactions are exempt; they aren't signed
+// by a sender with a nonce to track.
+func (bc *Blockchain) validateNonces(b Block) bool {
+	bc.ensureNonceIndex()
+	seen := make(map[string]int64, len(b.Transactions))
+	for _, tx := range b.Transactions {
+		if tx.From == "coinbase" {
+			continue
+		}
+		last, ok := seen[tx.From]
+		if !ok {
+			last = bc.nonceIndex[tx.From]
+		}
+		if tx.Nonce <= last {
+			fmt.Printf("Block %d validation failed: tx from %s replays nonce %d (last used %d)\n", b.Index, tx.From, tx.Nonce, last)
+			return false
+		}
+		seen[tx.From] = tx.Nonce
+	}
+	return true
+}
+
+// uncleWindow is how many blocks back an uncle's PrevHash may still point
+// to and be considered a recent-enough fork to reward (P2Pool-style).
+const uncleWindow = 6
+
+// validateUncles checks that every uncle referenced by b is a genuine,
+// not-yet-rewarded near-miss: valid PoW, a PrevHash within uncleWindow
+// blocks of b, and not already credited by an earlier block.
+func (bc *Blockchain) validateUncles(b Block, difficulty int, skipPow bool) bool {
+	if len(b.Uncles) > 2 {
+		fmt.Printf("Block %d validation failed: at most 2 uncles allowed, got %d\n", b.Index, len(b.Uncles))
+		return false
+	}
+	alreadyIncluded := make(map[string]bool)
+	for _, prior := range bc.Chain {
+		for _, u := range prior.Uncles {
+			alreadyIncluded[u.Hash] = true
+		}
+	}
+	for _, uncle := range b.Uncles {
+		if alreadyIncluded[uncle.Hash] {
+			fmt.Printf("Block %d validation failed: uncle %s already rewarded\n", b.Index, uncle.Hash)
+			return false
+		}
+		if !skipPow && calculateHash(uncle) != uncle.Hash {
+			fmt.Printf("Block %d validation failed: uncle %s hash mismatch\n", b.Index, uncle.Hash)
+			return false
+		}
+		if !skipPow && difficulty > 0 && len(uncle.Hash) >= difficulty {
+			prefix := strings.Repeat("0", difficulty)
+			if !strings.HasPrefix(uncle.Hash, prefix) {
+				fmt.Printf("Block %d validation failed: uncle %s does not meet difficulty %d\n", b.Index, uncle.Hash, difficulty)
+				return false
+			}
+		}
+		ancestorOK := false
+		for i := len(bc.Chain) - 1; i >= 0 && b.Index-bc.Chain[i].Index <= uncleWindow; i-- {
+			if bc.Chain[i].Hash == uncle.PrevHash {
+				ancestorOK = true
+				break
+			}
+		}
+		if !ancestorOK {
+			fmt.Printf("Block %d validation failed: uncle %s does not extend a recent ancestor\n", b.Index, uncle.Hash)
+			return false
+		}
+	}
+	return true
+}
+
+// IsProofHigherThanDifficulty returns the block's numeric proof of work,
+// 2^256/hash, mirroring P2Pool's sidechain weighting so forks can one day
+// be compared by cumulative work instead of just length.
+func (b Block) IsProofHigherThanDifficulty() *big.Int {
+	hashBytes, err := hex.DecodeString(b.Hash)
+	if err != nil || len(hashBytes) == 0 {
+		return big.NewInt(0)
+	}
+	hashInt := new(big.Int).SetBytes(hashBytes)
+	if hashInt.Sign() == 0 {
+		return new(big.Int).Lsh(big.NewInt(1), 256) // maximal proof for a zero hash
+	}
+	maxHash := new(big.Int).Lsh(big.NewInt(1), 256)
+	return new(big.Int).Quo(maxHash, hashInt)
+}
+
+// AddBlock - dodaje blok jeżeli walidacja przejdzie
+func (bc *Blockchain) AddBlock(b Block, difficulty int) bool {
+	return bc.AddBlockSkipPow(b, difficulty, false)
+}
+
+// AddBlockSkipPow - dodaje blok z opcjonalnym pominięciem sprawdzania PoW
+func (bc *Blockchain) AddBlockSkipPow(b Block, difficulty int, skipPow bool) bool {
+	if bc.validateBlock(b, difficulty, skipPow) {
+		// Stamp the difficulty the chain actually required, not whatever
+		// (if anything) the submitter's Block.Difficulty claimed -- this
+		// is what GetDynamicDifficulty's window average reads back later.
+		b.Difficulty = difficulty
+		// validateBlock -> validateNonces already called ensureNonceIndex,
+		// so nonceIndex reflects everything up to (not including) b here.
+		bc.Chain = append(bc.Chain, b)
+		bc.foldNonces(b)
+		bc.nonceIndexTip = len(bc.Chain)
+		return true
+	}
+	return false
+}
+
+// SaveToFile - zapisuje blockchain do pliku JSON
+func (bc *Blockchain) SaveToFile(path string) error {
+	data, err := json.MarshalIndent(bc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadFromFile - ładuje blockchain z pliku JSON; jeśli brak pliku tworzy genesis
+func (bc *Blockchain) LoadFromFile(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		// nowy blockchain z genesis
+		bc.Chain = []Block{createGenesisBlock()}
+		return bc.SaveToFile(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var tmp Blockchain
+	if err := json.Unmarshal(data, &tmp); err != nil {
+		return err
+	}
+	// dodatkowa kontrola: jeśli pusty -> genesis
+	if len(tmp.Chain) == 0 {
+		tmp.Chain = []Block{createGenesisBlock()}
+	}
+	// Verify persisted hashes instead of blindly recomputing them: silently
+	// overwriting Hash here would hide a block that was never legitimately
+	// mined (corruption, a stale powMode migration, or a tampered file
+	// would all just get their Hash field rewritten to match on load),
+	// defeating the same check validateBlock does on every new block.
+	for i := range tmp.Chain {
+		if want := calculateHash(tmp.Chain[i]); want != tmp.Chain[i].Hash {
+			fmt.Printf("LoadFromFile: block %d hash mismatch (stored %s, recalculated %s); chain file may be corrupt\n", tmp.Chain[i].Index, tmp.Chain[i].Hash, want)
+		}
+	}
+	bc.Chain = tmp.Chain
+	return nil
+}
+
+// rebuildHashIndex rebuilds the hash->index map from the current Chain.
+func (bc *Blockchain) rebuildHashIndex() {
+	bc.hashIndex = make(map[string]int, len(bc.Chain))
+	for i, b := range bc.Chain {
+		bc.hashIndex[b.Hash] = i
+	}
+}
+
+// IndexOfHash returns the chain index for a block hash, rebuilding the
+// lazy hash->index map first if it's missing or stale.
+func (bc *Blockchain) IndexOfHash(hash string) (int, bool) {
+	if bc.hashIndex == nil || len(bc.hashIndex) != len(bc.Chain) {
+		bc.rebuildHashIndex()
+	}
+	i, ok := bc.hashIndex[hash]
+	return i, ok
+}
+
+// RebuildHashIndex forces the hash->index map to be rebuilt from the
+// current Chain, for callers (sync's reorg rollback) that mutate Chain in
+// place instead of through AddBlock/AddBlockSkipPow.
+func (bc *Blockchain) RebuildHashIndex() {
+	bc.rebuildHashIndex()
+}
+
+// BlockLocator builds a Bitcoin-style block locator: an exponentially
+// spaced list of local block hashes (tip, tip-1, tip-2, tip-4, tip-8, ...,
+// genesis). A peer walks this list to find the first hash it recognizes,
+// giving O(log n) common-ancestor discovery instead of a linear range scan
+// -- and, unlike a plain height comparison, it still finds the right
+// ancestor when the two chains have forked.
+func (bc *Blockchain) BlockLocator() []string {
+	var locator []string
+	step := 1
+	for i := len(bc.Chain) - 1; i >= 0; {
+		locator = append(locator, bc.Chain[i].Hash)
+		if i == 0 {
+			break
+		}
+		i -= step
+		if i < 0 {
+			i = 0
+		}
+		if len(locator) >= 10 {
+			step *= 2
+		}
+	}
+	return locator
+}
+
+// HashesAfterLocator walks a peer-supplied locator to find the first hash
+// we also have, then returns up to max hashes following it (stopping early
+// at hashStop, if given). This is the server side of the getblocks/inv
+// exchange: the reply tells the peer exactly which blocks to getdata.
+func (bc *Blockchain) HashesAfterLocator(locator []string, hashStop string, max int) []string {
+	start := 0
+	for _, h := range locator {
+		if idx, ok := bc.IndexOfHash(h); ok {
+			start = idx + 1
+			break
+		}
+	}
+
+	var hashes []string
+	for i := start; i < len(bc.Chain) && len(hashes) < max; i++ {
+		hashes = append(hashes, bc.Chain[i].Hash)
+		if hashStop != "" && bc.Chain[i].Hash == hashStop {
+			break
+		}
+	}
+	return hashes
+}
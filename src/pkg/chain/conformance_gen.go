@@ -0,0 +1,379 @@
+package chain
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tosterlolz/Owonero/src/conformance"
+)
+
+const vectorsDir = "../../conformance/testdata/vectors"
+
+// resolveVectorsDir honors OWO_VECTORS_DIR so a third-party implementation
+// can point both the generator and the `go test -tags conformance` harness
+// at its own corpus instead of this repo's.
+func resolveVectorsDir() string {
+	if d := os.Getenv("OWO_VECTORS_DIR"); d != "" {
+		return d
+	}
+	return vectorsDir
+}
+
+// DumpVectors regenerates conformance/testdata/vectors from this package's
+// own calculateHash/SignTransaction/validateBlock/GetDynamicDifficulty,
+// the only place those unexported functions can be called directly.
+// cmd/owonero-daemon's `vectors dump` subcommand calls this.
+func DumpVectors() {
+	genesisVector()
+	hashStabilityVector()
+	signRoundTripVectors()
+	validateBlockFailureVectors()
+	dynamicDifficultyVectors()
+	powVectors()
+	nonceReplayVector()
+	negativeAmountVector()
+	coinbaseOnlyBlockVector()
+	reorgVector()
+	fmt.Printf("\033[32mWrote conformance vectors to %s\033[0m\n", resolveVectorsDir())
+}
+
+func mustSave(v conformance.Vector) {
+	if err := conformance.Save(resolveVectorsDir(), v); err != nil {
+		fmt.Printf("\033[31mconformance: failed to write %s: %v\033[0m\n", v.Name, err)
+		os.Exit(1)
+	}
+}
+
+// genesisVector pins createGenesisBlock().Hash: every node must derive the
+// exact same genesis hash or they are, by definition, on different chains.
+func genesisVector() {
+	g := createGenesisBlock()
+	input, _ := json.Marshal(g)
+	mustSave(conformance.Vector{
+		Name:     "genesis-determinism",
+		Kind:     conformance.KindBlock,
+		Input:    input,
+		Expected: conformance.Expected{Accept: true, Hash: g.Hash},
+	})
+}
+
+// hashStabilityVector pins calculateHash for a fixed, non-genesis block so
+// a future Go toolchain or refactor that accidentally changes hashing
+// (e.g. map key ordering, float formatting) is caught immediately.
+func hashStabilityVector() {
+	b := Block{
+		Index:        1,
+		Timestamp:    "2025-10-11T00:00:01Z",
+		Transactions: []Transaction{NewTransaction("OWOalice", "OWObob", 10)},
+		PrevHash:     createGenesisBlock().Hash,
+		Nonce:        12345,
+	}
+	b.Hash = calculateHash(b)
+	input, _ := json.Marshal(b)
+	mustSave(conformance.Vector{
+		Name:     "hash-stability",
+		Kind:     conformance.KindBlock,
+		Input:    input,
+		Expected: conformance.Expected{Accept: true, Hash: b.Hash},
+	})
+}
+
+func genKeyPair() (privPem, pubPem string) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	privBytes, _ := x509.MarshalECPrivateKey(priv)
+	pubBytes, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	privPem = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privBytes}))
+	pubPem = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes}))
+	return
+}
+
+// signRoundTripVectors covers VerifyTransactionSignature accepting a
+// correctly signed tx, rejecting it once tampered, and rejecting a
+// signature checked against the wrong public key.
+func signRoundTripVectors() {
+	privA, pubA := genKeyPair()
+	_, pubB := genKeyPair()
+
+	addrA, err := AddrFromPubKey(pubA)
+	if err != nil {
+		panic(err)
+	}
+
+	tx := NewTransaction(addrA, "OWObob", 10)
+	tx.PubKey = pubA
+	if err := SignTransaction(&tx, privA); err != nil {
+		panic(err)
+	}
+
+	good, _ := json.Marshal(struct {
+		Tx Transaction `json:"tx"`
+	}{Tx: tx})
+	mustSave(conformance.Vector{
+		Name:     "sign-roundtrip-ok",
+		Kind:     conformance.KindTx,
+		Input:    good,
+		Expected: conformance.Expected{Accept: true},
+	})
+
+	tampered := tx
+	tampered.Outputs = []TxOutput{{To: tampered.Outputs[0].To, Amount: 1000}}
+	tamperedJSON, _ := json.Marshal(struct {
+		Tx Transaction `json:"tx"`
+	}{Tx: tampered})
+	mustSave(conformance.Vector{
+		Name:     "sign-tampered-amount",
+		Kind:     conformance.KindTx,
+		Input:    tamperedJSON,
+		Expected: conformance.Expected{Accept: false, ErrorCode: "tampered"},
+	})
+
+	// wrongKey claims addrA as the sender but carries pubB, which doesn't
+	// hash to addrA -- this is exactly the spoof addrMatchesPubKey exists
+	// to catch, so it must be rejected before the signature is even checked.
+	wrongKey := tx
+	wrongKey.PubKey = pubB
+	wrongKeyJSON, _ := json.Marshal(struct {
+		Tx Transaction `json:"tx"`
+	}{Tx: wrongKey})
+	mustSave(conformance.Vector{
+		Name:     "sign-wrong-key",
+		Kind:     conformance.KindTx,
+		Input:    wrongKeyJSON,
+		Expected: conformance.Expected{Accept: false, ErrorCode: "wrong-key"},
+	})
+}
+
+// validateBlockFailureVectors covers the four failure reasons
+// validateBlock currently prints to stdout: bad prev-hash, bad index, bad
+// PoW, and a tx tampered with after the block was mined.
+func validateBlockFailureVectors() {
+	g := createGenesisBlock()
+	pre, _ := json.Marshal(Blockchain{Chain: []Block{g}})
+
+	next := MineBlock(g, []Transaction{NewTransaction("coinbase", "OWOminer", blockReward)}, 1, nil)
+
+	badPrev := next
+	badPrev.PrevHash = "deadbeef"
+	badPrevInput, _ := json.Marshal(badPrev)
+	mustSave(conformance.Vector{
+		Name:     "validate-bad-prevhash",
+		Kind:     conformance.KindChain,
+		PreState: pre,
+		Input:    badPrevInput,
+		Expected: conformance.Expected{Accept: false, ErrorCode: "bad-prevhash"},
+	})
+
+	badIndex := next
+	badIndex.Index = next.Index + 5
+	badIndexInput, _ := json.Marshal(badIndex)
+	mustSave(conformance.Vector{
+		Name:     "validate-bad-index",
+		Kind:     conformance.KindChain,
+		PreState: pre,
+		Input:    badIndexInput,
+		Expected: conformance.Expected{Accept: false, ErrorCode: "bad-index"},
+	})
+
+	badPow := next
+	badPow.Hash = "ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+	badPowInput, _ := json.Marshal(badPow)
+	mustSave(conformance.Vector{
+		Name:     "validate-bad-pow",
+		Kind:     conformance.KindChain,
+		PreState: pre,
+		Input:    badPowInput,
+		Expected: conformance.Expected{Accept: false, ErrorCode: "bad-pow"},
+	})
+
+	tamperedAfterMine := next
+	tamperedAfterMine.Transactions = append([]Transaction{}, next.Transactions...)
+	tamperedAfterMine.Transactions[0].Outputs[0].Amount += 1
+	tamperedInput, _ := json.Marshal(tamperedAfterMine)
+	mustSave(conformance.Vector{
+		Name:     "validate-tampered-tx",
+		Kind:     conformance.KindChain,
+		PreState: pre,
+		Input:    tamperedInput,
+		Expected: conformance.Expected{Accept: false, ErrorCode: "bad-hash"},
+	})
+}
+
+// dynamicDifficultyVectors pins GetDynamicDifficulty's clamp boundaries
+// (min 1, max 7) so a future change to its averaging window doesn't
+// silently widen or narrow them.
+func dynamicDifficultyVectors() {
+	bc := &Blockchain{}
+	bc.Chain = append(bc.Chain, createGenesisBlock())
+	mustSave(conformance.Vector{
+		Name:     "difficulty-below-window-clamps-min",
+		Kind:     conformance.KindChain,
+		Expected: conformance.Expected{Accept: true, ErrorCode: "1"},
+	})
+
+	// windowChain builds a >10-block chain (window is 10) so
+	// GetDynamicDifficulty actually reaches its averaging/clamp logic
+	// instead of taking the len(bc.Chain) <= window early return. lastDiff
+	// seeds the tip block's Difficulty -- what GetDynamicDifficulty
+	// adjusts from -- and gapSeconds spaces every block's Timestamp that
+	// far apart, driving the average block time over/under
+	// defaultTargetBlockTime.
+	windowChain := func(lastDiff, gapSeconds int) *Blockchain {
+		c := &Blockchain{}
+		g := createGenesisBlock()
+		c.Chain = append(c.Chain, g)
+		ts, _ := time.Parse(time.RFC3339, g.Timestamp)
+		for i := 1; i <= 10; i++ {
+			ts = ts.Add(time.Duration(gapSeconds) * time.Second)
+			b := Block{
+				Index:     i,
+				Timestamp: ts.Format(time.RFC3339),
+				PrevHash:  c.Chain[i-1].Hash,
+			}
+			if i == 10 {
+				b.Difficulty = lastDiff
+			}
+			c.Chain = append(c.Chain, b)
+		}
+		return c
+	}
+
+	// gapSeconds=1000 keeps the average block time far above the 30s
+	// target, so GetDynamicDifficulty wants to decrement from lastDiff=1 --
+	// this only clamps to 1 (not 7) if it's reading the tip's real
+	// Difficulty field rather than its Index (which would be 10, clamping
+	// to max 7 instead).
+	belowWindow := windowChain(1, 1000)
+	preState, _ := json.Marshal(belowWindow)
+	mustSave(conformance.Vector{
+		Name:     "difficulty-above-window-clamps-min",
+		Kind:     conformance.KindChain,
+		PreState: preState,
+		Expected: conformance.Expected{Accept: true, ErrorCode: "1"},
+	})
+
+	// gapSeconds=1 keeps the average block time far below the 30s target,
+	// so GetDynamicDifficulty wants to increment from lastDiff=7 and
+	// should clamp at the max instead of overshooting.
+	aboveWindow := windowChain(7, 1)
+	preState, _ = json.Marshal(aboveWindow)
+	mustSave(conformance.Vector{
+		Name:     "difficulty-above-window-clamps-max",
+		Kind:     conformance.KindChain,
+		PreState: preState,
+		Expected: conformance.Expected{Accept: true, ErrorCode: "7"},
+	})
+}
+
+// powVectors pre-mines blocks at difficulty 1..7 so a future PoW change
+// (see calculateHashDAG) can be checked against known-good nonces without
+// re-mining at every difficulty on every run.
+func powVectors() {
+	g := createGenesisBlock()
+	for difficulty := 1; difficulty <= 7; difficulty++ {
+		b := MineBlock(g, []Transaction{NewTransaction("coinbase", "OWOminer", blockReward)}, difficulty, nil)
+		input, _ := json.Marshal(b)
+		mustSave(conformance.Vector{
+			Name:     fmt.Sprintf("pow-difficulty-%d", difficulty),
+			Kind:     conformance.KindPow,
+			Input:    input,
+			Expected: conformance.Expected{Accept: true, Hash: b.Hash},
+		})
+	}
+}
+
+// nonceReplayVector covers a block replaying a nonce the same sender
+// already used in an earlier, already-chained block -- distinct from the
+// in-block replay validateBlockFailureVectors doesn't exercise.
+func nonceReplayVector() {
+	g := createGenesisBlock()
+	spent := MineBlock(g, []Transaction{
+		NewTransaction("coinbase", "OWOminer", blockReward),
+		{From: "OWOalice", Outputs: []TxOutput{{To: "OWObob", Amount: 10}}, Nonce: 1},
+	}, 1, nil)
+	pre, _ := json.Marshal(Blockchain{Chain: []Block{g, spent}})
+
+	replay := MineBlock(spent, []Transaction{
+		NewTransaction("coinbase", "OWOminer", blockReward),
+		{From: "OWOalice", Outputs: []TxOutput{{To: "OWObob", Amount: 10}}, Nonce: 1}, // already used in `spent`
+	}, 1, nil)
+	input, _ := json.Marshal(replay)
+	mustSave(conformance.Vector{
+		Name:     "validate-replayed-nonce",
+		Kind:     conformance.KindChain,
+		PreState: pre,
+		Input:    input,
+		Expected: conformance.Expected{Accept: false, ErrorCode: "replayed-nonce"},
+	})
+}
+
+// negativeAmountVector covers validateBlock's rejection of a transaction
+// carrying a negative amount, which would otherwise let a sender mint
+// balance for the recipient while debiting nothing of their own.
+func negativeAmountVector() {
+	g := createGenesisBlock()
+	pre, _ := json.Marshal(Blockchain{Chain: []Block{g}})
+
+	b := MineBlock(g, []Transaction{
+		NewTransaction("coinbase", "OWOminer", blockReward),
+		{From: "OWOalice", Outputs: []TxOutput{{To: "OWObob", Amount: -10}}, Nonce: 1},
+	}, 1, nil)
+	input, _ := json.Marshal(b)
+	mustSave(conformance.Vector{
+		Name:     "validate-negative-amount",
+		Kind:     conformance.KindChain,
+		PreState: pre,
+		Input:    input,
+		Expected: conformance.Expected{Accept: false, ErrorCode: "negative-amount"},
+	})
+}
+
+// coinbaseOnlyBlockVector covers the minimal valid block: just the miner's
+// coinbase payout and nothing else, which must still be accepted.
+func coinbaseOnlyBlockVector() {
+	g := createGenesisBlock()
+	pre, _ := json.Marshal(Blockchain{Chain: []Block{g}})
+
+	b := MineBlock(g, []Transaction{NewTransaction("coinbase", "OWOminer", blockReward)}, 1, nil)
+	input, _ := json.Marshal(b)
+	mustSave(conformance.Vector{
+		Name:     "validate-coinbase-only-block",
+		Kind:     conformance.KindChain,
+		PreState: pre,
+		Input:    input,
+		Expected: conformance.Expected{Accept: true, Hash: b.Hash},
+	})
+}
+
+// reorgVector covers a longer, valid fork replacing the tip: the pre_state
+// chain is 3 blocks deep, and the fork in Input re-mines from the genesis
+// with 3 blocks of its own, matching how p2p.SyncWithPeer truncates and
+// re-appends once it detects a height collision against a different hash.
+func reorgVector() {
+	g := createGenesisBlock()
+	b1 := MineBlock(g, []Transaction{NewTransaction("coinbase", "OWOminer", blockReward)}, 1, nil)
+	b2 := MineBlock(b1, []Transaction{NewTransaction("coinbase", "OWOminer", blockReward)}, 1, nil)
+	pre, _ := json.Marshal(Blockchain{Chain: []Block{g, b1, b2}})
+
+	f1 := MineBlock(g, []Transaction{NewTransaction("coinbase", "OWOrival", blockReward)}, 1, nil)
+	f2 := MineBlock(f1, []Transaction{NewTransaction("coinbase", "OWOrival", blockReward)}, 1, nil)
+	f3 := MineBlock(f2, []Transaction{NewTransaction("coinbase", "OWOrival", blockReward)}, 1, nil)
+	input, _ := json.Marshal([]Block{f1, f2, f3})
+
+	mustSave(conformance.Vector{
+		Name:     "reorg-longer-fork-replaces-tip",
+		Kind:     conformance.KindReorg,
+		PreState: pre,
+		Input:    input,
+		Expected: conformance.Expected{Accept: true, Hash: f3.Hash},
+	})
+}
@@ -0,0 +1,339 @@
+package chain
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// keccak256/keccak512 are the original Keccak padding (0x01), not NIST
+// SHA3's (0x06) -- golang.org/x/crypto/sha3's Sum256/Sum512 are NIST SHA3,
+// so the DAG (which was specified against real Keccak, ethash-style) uses
+// these legacy constructors instead.
+func keccak256(data []byte) [32]byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	var out [32]byte
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+func keccak512(data []byte) [64]byte {
+	h := sha3.NewLegacyKeccak512()
+	h.Write(data)
+	var out [64]byte
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+// Epoch-based, ethash-inspired memory-hard DAG. The rx/owo "scratchpad"
+// only ever touched a 1MB buffer at 8 predictable offsets, so it was
+// neither memory-hard nor ASIC-resistant. This splits the work into a
+// small per-epoch cache (derived from a chained seed hash) and a much
+// larger dataset derived from that cache, the way ethash does.
+
+const (
+	epochLength           = 30000            // blocks per epoch before the seed/cache/dataset rotate
+	CacheSize             = 16 * 1024 * 1024 // ~16MB cache
+	cacheElemSize         = 64               // bytes per cache/dataset element
+	datasetBaseSize       = 1 << 30          // ~1GB dataset at epoch 0
+	datasetGrowthPerEpoch = 8 * 1024 * 1024  // dataset grows 8MB per epoch
+	mixBytes              = 128              // width of the hashimoto mix buffer
+	fnvPrime              = 0x01000193
+)
+
+// powMode selects which proof-of-work calculateHash/MineBlock use.
+// "dagowo" (default) is the epoch-based memory-hard DAG below;
+// "rxowo-legacy" keeps the original 1MB-scratchpad algorithm so blocks
+// mined before this change still validate. Set via SetPowMode.
+var powMode = "dagowo"
+
+// SetPowMode selects the active proof-of-work scheme: "dagowo" (default)
+// or "rxowo-legacy". Meant to be called once at startup from a CLI flag.
+func SetPowMode(mode string) {
+	powMode = mode
+}
+
+// DAGEpoch is the cache (and the seed it was derived from) for one epoch.
+// Full dataset items are derived from the cache on demand via
+// calcDatasetItem rather than materialized up front.
+type DAGEpoch struct {
+	Epoch int
+	Seed  [32]byte
+	cache [][cacheElemSize]byte
+}
+
+var (
+	dagMu       sync.Mutex
+	currentDAG  *DAGEpoch
+	autoDAGOn   int32
+	autoDAGStop chan struct{}
+)
+
+// EpochOf returns the DAG epoch a given block index falls in.
+func EpochOf(blockIndex int) int { return blockIndex / epochLength }
+
+// seedHash chains real keccak256 (see keccak256 above) starting from 32
+// zero bytes, `epoch` times, exactly as ethash derives its epoch seeds.
+func seedHash(epoch int) [32]byte {
+	var seed [32]byte
+	for i := 0; i < epoch; i++ {
+		seed = keccak256(seed[:])
+	}
+	return seed
+}
+
+func dagDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = "."
+	}
+	return filepath.Join(home, ".owonero", "dag")
+}
+
+// generateCache derives the ~16MB cache for an epoch by chaining real
+// keccak512 (see keccak512 above) from the epoch's seed hash.
+func generateCache(epoch int) [][cacheElemSize]byte {
+	seed := seedHash(epoch)
+	numElems := CacheSize / cacheElemSize
+	cache := make([][cacheElemSize]byte, numElems)
+	prev := keccak512(seed[:])
+	cache[0] = prev
+	for i := 1; i < numElems; i++ {
+		prev = keccak512(prev[:])
+		cache[i] = prev
+	}
+	return cache
+}
+
+// MakeDAG returns the cache for an epoch, loading it from
+// ~/.owonero/dag/cache-<epoch>.bin if present, otherwise generating and
+// persisting it. Light clients (verifiers) only ever need this cache;
+// full miners derive dataset items from it on the fly via
+// calcDatasetItem.
+func MakeDAG(epoch int) (*DAGEpoch, error) {
+	dagMu.Lock()
+	defer dagMu.Unlock()
+	if currentDAG != nil && currentDAG.Epoch == epoch {
+		return currentDAG, nil
+	}
+
+	path := filepath.Join(dagDir(), fmt.Sprintf("cache-%d.bin", epoch))
+	var cache [][cacheElemSize]byte
+	if data, err := os.ReadFile(path); err == nil && len(data) == CacheSize {
+		cache = make([][cacheElemSize]byte, CacheSize/cacheElemSize)
+		for i := range cache {
+			copy(cache[i][:], data[i*cacheElemSize:(i+1)*cacheElemSize])
+		}
+	} else {
+		cache = generateCache(epoch)
+		if mkErr := os.MkdirAll(dagDir(), 0755); mkErr == nil {
+			flat := make([]byte, 0, CacheSize)
+			for _, c := range cache {
+				flat = append(flat, c[:]...)
+			}
+			_ = os.WriteFile(path, flat, 0644)
+		}
+	}
+
+	d := &DAGEpoch{Epoch: epoch, Seed: seedHash(epoch), cache: cache}
+	currentDAG = d
+	return d, nil
+}
+
+func datasetSize(epoch int) int64 {
+	return datasetBaseSize + datasetGrowthPerEpoch*int64(epoch)
+}
+
+// fnv1 is ethash's FNV-based mixing primitive.
+func fnv1(a, b uint32) uint32 {
+	return (a * fnvPrime) ^ b
+}
+
+func bytesToWords(b []byte) []uint32 {
+	words := make([]uint32, len(b)/4)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return words
+}
+
+func wordsToBytes(words []uint32, out []byte) {
+	for i, w := range words {
+		binary.LittleEndian.PutUint32(out[i*4:], w)
+	}
+}
+
+// calcDatasetItem derives dataset element i from the epoch cache using 256
+// rounds of FNV-mixing over cache slices indexed by fnv(i^round, mix
+// word), the same shape as ethash's dataset generation.
+func calcDatasetItem(cache [][cacheElemSize]byte, i uint32) [cacheElemSize]byte {
+	n := uint32(len(cache))
+	mix := cache[i%n]
+	mixWords := bytesToWords(mix[:])
+	mixWords[0] ^= i
+	for round := uint32(0); round < 256; round++ {
+		parent := fnv1(i^round, mixWords[round%uint32(len(mixWords))]) % n
+		parentWords := bytesToWords(cache[parent][:])
+		for j := range mixWords {
+			mixWords[j] = fnv1(mixWords[j], parentWords[j])
+		}
+	}
+	var mixed [cacheElemSize]byte
+	wordsToBytes(mixWords, mixed[:])
+	return keccak512(mixed[:])
+}
+
+// hashimoto computes the full-mix PoW hash for (headerHash, nonce): a
+// 128-byte mix is expanded from real keccak512(headerHash||nonce), 64
+// rounds each FNV-mix in one dataset element selected by
+// fnv(i^nonce_lo, mix_word) % dataset_len, the mix folds to 32 bytes, and
+// the final hash is real keccak256(headerHash||mix||nonce).
+func hashimoto(headerHash []byte, nonce uint64, datasetLen uint32, lookup func(uint32) [cacheElemSize]byte) (mixDigest [32]byte, result [32]byte) {
+	nonceBytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(nonceBytes, nonce)
+
+	seedInput := make([]byte, 0, len(headerHash)+8)
+	seedInput = append(seedInput, headerHash...)
+	seedInput = append(seedInput, nonceBytes...)
+	seed := keccak512(seedInput)
+
+	mixWords := make([]uint32, mixBytes/4)
+	seedWords := bytesToWords(seed[:])
+	for i := range mixWords {
+		mixWords[i] = seedWords[i%len(seedWords)]
+	}
+
+	nonceLo := uint32(nonce)
+	for i := uint32(0); i < 64; i++ {
+		parent := fnv1(i^nonceLo, mixWords[i%uint32(len(mixWords))]) % datasetLen
+		item := lookup(parent)
+		itemWords := bytesToWords(item[:])
+		for j := range mixWords {
+			mixWords[j] = fnv1(mixWords[j], itemWords[j%len(itemWords)])
+		}
+	}
+
+	folded := make([]byte, 32)
+	for i := 0; i < 8; i++ {
+		v := mixWords[i] ^ mixWords[i+8] ^ mixWords[i+16] ^ mixWords[i+24]
+		binary.LittleEndian.PutUint32(folded[i*4:], v)
+	}
+	copy(mixDigest[:], folded)
+
+	final := make([]byte, 0, len(headerHash)+32+8)
+	final = append(final, headerHash...)
+	final = append(final, folded...)
+	final = append(final, nonceBytes...)
+	result = keccak256(final)
+	return mixDigest, result
+}
+
+// headerHashFor hashes everything about a block except its nonce (real
+// keccak256, see keccak256 above), so the hashimoto seed changes only
+// when the nonce is retried.
+func headerHashFor(b Block) [32]byte {
+	header := BlockForHash{
+		Index:        b.Index,
+		Timestamp:    b.Timestamp,
+		Transactions: b.Transactions,
+		PrevHash:     b.PrevHash,
+		Uncles:       b.Uncles,
+		Beacon:       b.Beacon,
+	}
+	headerBytes, _ := json.Marshal(header)
+	return keccak256(headerBytes)
+}
+
+// calculateHashDAG is the DAG-based replacement for calculateHashLegacy.
+func calculateHashDAG(b Block) string {
+	headerHash := headerHashFor(b)
+	epoch := EpochOf(b.Index)
+	dag, err := MakeDAG(epoch)
+	if err != nil {
+		return ""
+	}
+	datasetLen := uint32(datasetSize(epoch) / cacheElemSize)
+	_, result := hashimoto(headerHash[:], uint64(b.Nonce), datasetLen, func(i uint32) [cacheElemSize]byte {
+		return calcDatasetItem(dag.cache, i)
+	})
+	return hex.EncodeToString(result[:])
+}
+
+// mineBlockDAG is the DAG-based replacement for mineBlockLegacy.
+func mineBlockDAG(prev Block, txs []Transaction, difficulty int, attemptsPtr *int64, uncles ...Block) Block {
+	var b Block
+	b.Index = prev.Index + 1
+	b.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	b.Transactions = txs
+	b.PrevHash = prev.Hash
+	b.Uncles = uncles
+	b.Beacon = nextBeaconEntry(prev, b.Index)
+
+	epoch := EpochOf(b.Index)
+	dag, err := MakeDAG(epoch)
+	if err != nil {
+		return b
+	}
+	datasetLen := uint32(datasetSize(epoch) / cacheElemSize)
+	headerHash := headerHashFor(b)
+	lookup := func(i uint32) [cacheElemSize]byte { return calcDatasetItem(dag.cache, i) }
+
+	prefix := ""
+	for i := 0; i < difficulty; i++ {
+		prefix += "0"
+	}
+
+	nonce := 0
+	for {
+		_, result := hashimoto(headerHash[:], uint64(nonce), datasetLen, lookup)
+		if attemptsPtr != nil {
+			atomic.AddInt64(attemptsPtr, 1)
+		}
+		hash := hex.EncodeToString(result[:])
+		if len(hash) >= len(prefix) && hash[:len(prefix)] == prefix {
+			b.Nonce = nonce
+			b.Hash = hash
+			return b
+		}
+		nonce++
+	}
+}
+
+// StartAutoDAG prebuilds the next epoch's cache in the background, the
+// way quorum's admin miner lets operators pre-warm an epoch transition
+// instead of stalling at the boundary.
+func StartAutoDAG(fromEpoch int) {
+	if !atomic.CompareAndSwapInt32(&autoDAGOn, 0, 1) {
+		return
+	}
+	autoDAGStop = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-autoDAGStop:
+				return
+			case <-ticker.C:
+				_, _ = MakeDAG(fromEpoch + 1)
+			}
+		}
+	}()
+}
+
+// StopAutoDAG stops the background epoch pre-warmer started by
+// StartAutoDAG.
+func StopAutoDAG() {
+	if atomic.CompareAndSwapInt32(&autoDAGOn, 1, 0) {
+		close(autoDAGStop)
+	}
+}
@@ -0,0 +1,177 @@
+package chain
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+)
+
+// HistoryEntry is one line of an address's transaction history: the wire
+// format the daemon's gethistory command returns. Height is -1 for a
+// mempool-pending transaction that hasn't been mined yet.
+type HistoryEntry struct {
+	TxID         string `json:"txid"`
+	Height       int    `json:"height"`
+	Time         string `json:"time"`
+	Counterparty string `json:"counterparty"`
+	Delta        int64  `json:"delta"`
+}
+
+// HistoryIndex is an incrementally-maintained, per-address transaction
+// history, living alongside BalanceIndex for the same reason: this chain's
+// account model has no UTXO set to scan for "every transaction touching
+// this address", so this plays that role instead of rescanning the whole
+// chain (and mempool) on every gethistory call.
+type HistoryIndex struct {
+	mu      sync.RWMutex
+	History map[string][]HistoryEntry `json:"history"`
+	Height  int                       `json:"height"` // reflects the chain up through this block index; -1 if empty
+}
+
+// NewHistoryIndex returns an empty index, as if no blocks had been applied.
+func NewHistoryIndex() *HistoryIndex {
+	return &HistoryIndex{History: make(map[string][]HistoryEntry), Height: -1}
+}
+
+// recipientCounterparty summarizes a transaction's outputs for the sender's
+// own history row, since a sender's single debit entry has no one "To" to
+// name the way each recipient's credit entry names tx.From.
+func recipientCounterparty(outputs []TxOutput) string {
+	parts := make([]string, len(outputs))
+	for i, o := range outputs {
+		parts[i] = o.To
+	}
+	return strings.Join(parts, ",")
+}
+
+// addLocked appends tx's entries (one credit per output, one debit for the
+// sender) at the given height/timestamp. Caller must hold idx.mu.
+func (h *HistoryIndex) addLocked(tx Transaction, height int, timestamp string) {
+	id := TxID(tx)
+	for _, o := range tx.Outputs {
+		h.History[o.To] = append(h.History[o.To], HistoryEntry{
+			TxID:         id,
+			Height:       height,
+			Time:         timestamp,
+			Counterparty: tx.From,
+			Delta:        int64(o.Amount),
+		})
+	}
+	h.History[tx.From] = append(h.History[tx.From], HistoryEntry{
+		TxID:         id,
+		Height:       height,
+		Time:         timestamp,
+		Counterparty: recipientCounterparty(tx.Outputs),
+		Delta:        -int64(tx.TotalOut()),
+	})
+}
+
+// removePendingLocked drops any Height -1 rows for id, once it's been mined
+// and ApplyBlock is about to add the confirmed rows in their place. Caller
+// must hold idx.mu.
+func (h *HistoryIndex) removePendingLocked(id string) {
+	for addr, entries := range h.History {
+		kept := entries[:0]
+		for _, e := range entries {
+			if e.TxID == id && e.Height == -1 {
+				continue
+			}
+			kept = append(kept, e)
+		}
+		h.History[addr] = kept
+	}
+}
+
+// ApplyPending records tx as seen in the mempool, not yet confirmed, so
+// gethistory can show it immediately instead of only once it's mined.
+// Mempool.Insert calls this on every successful insert.
+func (h *HistoryIndex) ApplyPending(tx Transaction) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.addLocked(tx, -1, "")
+}
+
+// ApplyBlock folds one more block's transactions into the index, clearing
+// out any pending rows the block's transactions superseded first. Callers
+// appending a newly mined block should call this instead of Rebuild so the
+// cost stays O(txs in the block) rather than O(chain).
+func (h *HistoryIndex) ApplyBlock(b Block) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, tx := range b.Transactions {
+		h.removePendingLocked(TxID(tx))
+		h.addLocked(tx, b.Index, b.Timestamp)
+	}
+	h.Height = b.Index
+}
+
+// Query returns address's history in reverse-chronological order (most
+// recent first, with any still-pending entries ahead of confirmed ones),
+// capped to limit entries (0 means unlimited). beforeHeight, when > 0,
+// restricts the result to confirmed entries strictly below that height and
+// excludes pending ones, so a caller can page through older history by
+// passing the height of the last entry it already saw.
+func (h *HistoryIndex) Query(address string, limit int, beforeHeight int) []HistoryEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	entries := h.History[address]
+	out := make([]HistoryEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if beforeHeight > 0 && (e.Height < 0 || e.Height >= beforeHeight) {
+			continue
+		}
+		out = append(out, e)
+		if limit > 0 && len(out) >= limit {
+			break
+		}
+	}
+	return out
+}
+
+// SaveToFile persists the index, mirroring BalanceIndex.SaveToFile.
+func (h *HistoryIndex) SaveToFile(path string) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (h *HistoryIndex) loadFromFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return json.Unmarshal(data, h)
+}
+
+// Rebuild replaces the index's contents by refolding the whole chain from
+// genesis. Used on startup when the persisted index is missing or stale
+// (its Height doesn't match the chain tip).
+func (h *HistoryIndex) Rebuild(bc *Blockchain) {
+	h.mu.Lock()
+	h.History = make(map[string][]HistoryEntry)
+	h.Height = -1
+	h.mu.Unlock()
+	for _, b := range bc.Chain {
+		h.ApplyBlock(b)
+	}
+}
+
+// BuildHistoryIndex loads path if present and already reflects bc's current
+// tip, otherwise rebuilds it from genesis and persists the result.
+func BuildHistoryIndex(bc *Blockchain, path string) *HistoryIndex {
+	h := NewHistoryIndex()
+	if err := h.loadFromFile(path); err == nil && h.Height == len(bc.Chain)-1 {
+		return h
+	}
+	h.Rebuild(bc)
+	_ = h.SaveToFile(path)
+	return h
+}
@@ -0,0 +1,173 @@
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// BlockHeader is a compact summary of a Block for header-first sync:
+// everything needed to check PoW linkage and estimate chain work, without
+// transporting every block's full transaction list. Full validation (tx
+// signatures, nonces, balances) still happens once the actual Block is
+// fetched and run through validateBlock.
+type BlockHeader struct {
+	Index     int    `json:"index"`
+	Timestamp string `json:"timestamp"`
+	PrevHash  string `json:"prev_hash"`
+	Hash      string `json:"hash"`
+	Nonce     int    `json:"nonce"`
+}
+
+// Header returns b's compact BlockHeader.
+func (b Block) Header() BlockHeader {
+	return BlockHeader{
+		Index:     b.Index,
+		Timestamp: b.Timestamp,
+		PrevHash:  b.PrevHash,
+		Hash:      b.Hash,
+		Nonce:     b.Nonce,
+	}
+}
+
+// HeadersInRange returns the headers for blocks [start, end), end capped to
+// the chain's current length. This is the server side of the getheaders
+// command.
+func (bc *Blockchain) HeadersInRange(start, end int) []BlockHeader {
+	if start < 0 {
+		start = 0
+	}
+	if end > len(bc.Chain) {
+		end = len(bc.Chain)
+	}
+	var headers []BlockHeader
+	for i := start; i < end; i++ {
+		headers = append(headers, bc.Chain[i].Header())
+	}
+	return headers
+}
+
+// leadingZeroNibbles counts hash's leading hex '0' characters.
+func leadingZeroNibbles(hash string) int {
+	n := 0
+	for n < len(hash) && hash[n] == '0' {
+		n++
+	}
+	return n
+}
+
+// headerWork estimates the work a single header represents as 16^n, where
+// n is its hash's leading hex-zero count -- each extra leading zero is a
+// 16x harder target to hit, mirroring the nibble-based difficulty check
+// validateBlock itself uses.
+func headerWork(h BlockHeader) *big.Int {
+	work := big.NewInt(1)
+	sixteen := big.NewInt(16)
+	for i := 0; i < leadingZeroNibbles(h.Hash); i++ {
+		work.Mul(work, sixteen)
+	}
+	return work
+}
+
+// CumulativeWork sums headerWork across headers, the basis for picking the
+// best-work chain among several peers instead of just the longest one.
+func CumulativeWork(headers []BlockHeader) *big.Int {
+	total := new(big.Int)
+	for _, h := range headers {
+		total.Add(total, headerWork(h))
+	}
+	return total
+}
+
+// ValidHeaderChain does the best a header-only peer can do before
+// committing to downloading the full blocks behind them: checks that each
+// header's PrevHash links to the previous header's Hash (headers[0] is
+// exempt -- its PrevHash is checked against the caller's own tip instead,
+// since it's usually a continuation rather than genesis), that every
+// header actually has a hash (a block that never finished mining has
+// none), and that the claimed hash meets at least minDifficulty leading
+// zero nibbles. That last check is only a floor, not real PoW
+// verification: BlockHeader carries no Transactions/Uncles/Beacon, so
+// there's no way to recompute the header's real hash (calculateHash needs
+// the full Block) and confirm this hash was honestly derived from it --
+// a peer could still hand us a header whose Hash just happens to meet
+// the floor without corresponding to any real block. It does reject the
+// cheap case of headers that were never mined at all. Full PoW/tx/nonce
+// validation happens later against the real downloaded Block, via
+// validateBlock's calculateHash(b) != b.Hash check (which always runs,
+// even with skipPow set -- see AddBlockSkipPow's callers in p2p).
+func ValidHeaderChain(headers []BlockHeader, minDifficulty int) bool {
+	for i, h := range headers {
+		if h.Hash == "" {
+			return false
+		}
+		if i > 0 && h.PrevHash != headers[i-1].Hash {
+			return false
+		}
+		if leadingZeroNibbles(h.Hash) < minDifficulty {
+			return false
+		}
+	}
+	return true
+}
+
+// Snapshot is a CAR-like (content-addressed archive) bundle of the chain
+// and balance index as of Height, so a fresh peer can bootstrap from one
+// transfer instead of replaying every block, then catch up the rest via
+// getheaders. Each section carries its own content hash so loadsnapshot
+// can detect truncation/tampering before trusting any of it.
+type Snapshot struct {
+	Height      int              `json:"height"`
+	Blocks      []Block          `json:"blocks"`
+	BlocksCID   string           `json:"blocks_cid"`
+	Balances    map[string]int64 `json:"balances"`
+	BalancesCID string           `json:"balances_cid"`
+}
+
+// contentID is the hex sha256 of data, Snapshot's content address.
+func contentID(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// BuildSnapshot assembles a Snapshot of bc and idx as of their current tip.
+func BuildSnapshot(bc *Blockchain, idx *BalanceIndex) Snapshot {
+	s := Snapshot{
+		Height:   len(bc.Chain) - 1,
+		Blocks:   bc.Chain,
+		Balances: idx.Balances,
+	}
+	blocksJSON, _ := json.Marshal(s.Blocks)
+	s.BlocksCID = contentID(blocksJSON)
+	balancesJSON, _ := json.Marshal(s.Balances)
+	s.BalancesCID = contentID(balancesJSON)
+	return s
+}
+
+// Verify checks that s's sections still match their own content ids, and
+// that the blocks form a properly linked, hashed chain from genesis --
+// everything a peer must confirm before replacing its local state with s.
+func (s Snapshot) Verify() error {
+	blocksJSON, _ := json.Marshal(s.Blocks)
+	if contentID(blocksJSON) != s.BlocksCID {
+		return fmt.Errorf("snapshot: blocks content does not match blocks_cid")
+	}
+	balancesJSON, _ := json.Marshal(s.Balances)
+	if contentID(balancesJSON) != s.BalancesCID {
+		return fmt.Errorf("snapshot: balances content does not match balances_cid")
+	}
+	for i, b := range s.Blocks {
+		if b.Index != i {
+			return fmt.Errorf("snapshot: block at position %d has index %d", i, b.Index)
+		}
+		if i > 0 && b.PrevHash != s.Blocks[i-1].Hash {
+			return fmt.Errorf("snapshot: block %d does not link to block %d", i, i-1)
+		}
+		if calculateHash(b) != b.Hash {
+			return fmt.Errorf("snapshot: block %d hash does not recompute", i)
+		}
+	}
+	return nil
+}
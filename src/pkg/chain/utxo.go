@@ -0,0 +1,105 @@
+package chain
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// BalanceIndex is an incrementally-maintained cache of each address's
+// spendable balance. This chain uses an account+nonce transaction model
+// rather than discrete unspent outputs, so there's no (txid, vout) set the
+// way a true UTXO chain would have; this plays the same role gocoin's
+// BlockChain.Unspent does -- O(1) balance and double-spend lookups instead
+// of rescanning every block on every call -- scoped to what this model
+// actually tracks: a running balance per address.
+type BalanceIndex struct {
+	mu       sync.RWMutex
+	Balances map[string]int64 `json:"balances"`
+	Height   int              `json:"height"` // reflects the chain up through this block index; -1 if empty
+}
+
+// NewBalanceIndex returns an empty index, as if no blocks had been applied.
+func NewBalanceIndex() *BalanceIndex {
+	return &BalanceIndex{Balances: make(map[string]int64), Height: -1}
+}
+
+// ApplyBlock folds one more block's transactions into the index, the same
+// credit/debit rule wallet.GetBalance's chain scan used: each output's To
+// gains its Amount, From loses TotalOut(). Callers appending a newly mined
+// block should call this instead of Rebuild so the cost stays O(txs in the
+// block) rather than O(chain).
+func (idx *BalanceIndex) ApplyBlock(b Block) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, tx := range b.Transactions {
+		for _, o := range tx.Outputs {
+			idx.Balances[o.To] += int64(o.Amount)
+		}
+		idx.Balances[tx.From] -= int64(tx.TotalOut())
+	}
+	idx.Height = b.Index
+}
+
+// Balance returns address's current spendable balance.
+func (idx *BalanceIndex) Balance(address string) int64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.Balances[address]
+}
+
+// SaveToFile persists the index, mirroring Blockchain.SaveToFile.
+func (idx *BalanceIndex) SaveToFile(path string) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (idx *BalanceIndex) loadFromFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return json.Unmarshal(data, idx)
+}
+
+// Rebuild replaces the index's contents by refolding the whole chain from
+// genesis. Used on startup when the persisted index is missing or stale
+// (its Height doesn't match the chain tip), and after a reorg, where
+// ApplyBlock alone can't undo the rolled-back side of the fork.
+func (idx *BalanceIndex) Rebuild(bc *Blockchain) {
+	idx.mu.Lock()
+	idx.Balances = make(map[string]int64)
+	idx.Height = -1
+	idx.mu.Unlock()
+	for _, b := range bc.Chain {
+		idx.ApplyBlock(b)
+	}
+}
+
+// LoadSnapshot replaces the index's contents wholesale with balances/height
+// from a verified Snapshot, instead of folding it in block by block.
+func (idx *BalanceIndex) LoadSnapshot(balances map[string]int64, height int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.Balances = balances
+	idx.Height = height
+}
+
+// BuildBalanceIndex loads path if present and already reflects bc's current
+// tip, otherwise rebuilds it from genesis and persists the result.
+func BuildBalanceIndex(bc *Blockchain, path string) *BalanceIndex {
+	idx := NewBalanceIndex()
+	if err := idx.loadFromFile(path); err == nil && idx.Height == len(bc.Chain)-1 {
+		return idx
+	}
+	idx.Rebuild(bc)
+	_ = idx.SaveToFile(path)
+	return idx
+}
@@ -0,0 +1,131 @@
+// Package p2p holds everything the daemon needs to talk to other nodes
+// and track chain state received over the network: peer bookkeeping,
+// block-locator sync, and TLS dialing. It depends on pkg/chain but never
+// the other way around.
+package p2p
+
+import (
+	"sync"
+
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
+)
+
+// Peer represents a network peer
+type Peer struct {
+	Address string `json:"address"`
+}
+
+type WalletInfo struct {
+	Address       string `json:"address"`
+	TotalReceived int64  `json:"total_received"`
+	TotalSent     int64  `json:"total_sent"`
+	Balance       int64  `json:"balance"`
+}
+
+// PeerManager manages the list of known peers, plus which of them have
+// recently announced themselves as active miners (see MarkMinerActive),
+// so the web-stats server and RPC server can both read miner-activity
+// state via the PeerManager they already hold instead of a shared global.
+type PeerManager struct {
+	peers    []Peer
+	mutex    sync.RWMutex
+	miners   map[string]bool
+	knownInv map[string]map[string]bool // peer address -> block hashes it's known to have
+}
+
+// AddPeer adds a new peer to the list if not already present
+func (pm *PeerManager) AddPeer(address string) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	for _, p := range pm.peers {
+		if p.Address == address {
+			return
+		}
+	}
+	pm.peers = append(pm.peers, Peer{Address: address})
+}
+
+// GetPeers returns a copy of the current peer list
+func (pm *PeerManager) GetPeers() []Peer {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	peers := make([]Peer, len(pm.peers))
+	copy(peers, pm.peers)
+	return peers
+}
+
+// RemovePeer removes a peer from the list
+func (pm *PeerManager) RemovePeer(address string) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	for i, p := range pm.peers {
+		if p.Address == address {
+			pm.peers = append(pm.peers[:i], pm.peers[i+1:]...)
+			break
+		}
+	}
+}
+
+// MarkMinerActive records that addr announced itself via "mineractive" on
+// the legacy TCP protocol.
+func (pm *PeerManager) MarkMinerActive(addr string) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	if pm.miners == nil {
+		pm.miners = make(map[string]bool)
+	}
+	pm.miners[addr] = true
+}
+
+// ActiveMinerCount returns how many distinct miners have announced
+// themselves active.
+func (pm *PeerManager) ActiveMinerCount() int {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	return len(pm.miners)
+}
+
+// MarkInvKnown records that peerAddr has (or has been sent) hash, so a
+// future inv broadcast doesn't resend it.
+func (pm *PeerManager) MarkInvKnown(peerAddr, hash string) {
+	pm.mutex.Lock()
+	defer pm.mutex.Unlock()
+	if pm.knownInv == nil {
+		pm.knownInv = make(map[string]map[string]bool)
+	}
+	if pm.knownInv[peerAddr] == nil {
+		pm.knownInv[peerAddr] = make(map[string]bool)
+	}
+	pm.knownInv[peerAddr][hash] = true
+}
+
+// PeerKnowsInv reports whether peerAddr is already known to have hash.
+func (pm *PeerManager) PeerKnowsInv(peerAddr, hash string) bool {
+	pm.mutex.RLock()
+	defer pm.mutex.RUnlock()
+	return pm.knownInv[peerAddr][hash]
+}
+
+// GetWalletInfo scans the blockchain for every transaction touching
+// address and totals what it received/sent.
+func GetWalletInfo(address string, bc *chain.Blockchain) *WalletInfo {
+	var totalReceived, totalSent int64
+	for _, block := range bc.Chain {
+		for _, tx := range block.Transactions {
+			for _, o := range tx.Outputs {
+				if o.To == address {
+					totalReceived += int64(o.Amount)
+				}
+			}
+			if tx.From == address {
+				totalSent += int64(tx.TotalOut())
+			}
+		}
+	}
+	return &WalletInfo{
+		Address:       address,
+		TotalReceived: totalReceived,
+		TotalSent:     totalSent,
+		Balance:       totalReceived - totalSent,
+	}
+}
@@ -0,0 +1,176 @@
+package p2p
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
+)
+
+// GetBlocksRequest is the body line following a "getblocks" command: a
+// Bitcoin-style block locator (see chain.Blockchain.BlockLocator) plus an
+// optional hashstop bounding how far the peer's inv reply extends.
+type GetBlocksRequest struct {
+	Locator  []string `json:"locator"`
+	HashStop string   `json:"hashstop,omitempty"`
+}
+
+// MaxInvHashes caps how many hashes a single getblocks reply carries,
+// mirroring Bitcoin's inv message limit.
+const MaxInvHashes = 500
+
+// SyncWithPeer attempts to sync blockchain with a specific peer using a
+// block locator instead of a linear height range: we send an
+// exponentially-spaced list of our own block hashes so the peer can find
+// our common ancestor in O(log n) even across a reorg, get back an inv of
+// the hashes that follow it, and getdata only the ones we're missing. If a
+// returned block's index collides with one we already have a different
+// hash for, we're on the losing side of a fork, so we roll back to the
+// ancestor before appending -- this is what gives us automatic reorg
+// handling in place of the old getheight + getblocks <start> <end> dialog.
+// chainFile is where bc is persisted once the sync completes. idx/hidx, if
+// not nil, are rebuilt and persisted to utxoFile/historyFile after a
+// successful sync -- a full rebuild rather than an incremental ApplyBlock
+// per block, since a reorg here can roll back part of what they already
+// applied.
+func SyncWithPeer(peerAddr string, bc *chain.Blockchain, pm *PeerManager, chainFile string, idx *chain.BalanceIndex, utxoFile string, hidx *chain.HistoryIndex, historyFile string) error {
+	fmt.Printf("\033[36mAttempting to sync with peer %s\033[0m\n", peerAddr)
+	conn, err := DialPeer(peerAddr)
+	if err != nil {
+		return fmt.Errorf("cannot connect to peer %s: %v", peerAddr, err)
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	// Read and ignore greeting line
+	if greeting, err := reader.ReadString('\n'); err == nil {
+		fmt.Printf("\033[32mConnected to peer %s: %s\033[0m", peerAddr, strings.TrimSpace(greeting))
+	}
+
+	fmt.Fprintf(conn, "getblocks\n")
+	reqBytes, _ := json.Marshal(GetBlocksRequest{Locator: bc.BlockLocator()})
+	fmt.Fprintf(conn, "%s\n", reqBytes)
+
+	invLine, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("cannot read inv from peer: %v", err)
+	}
+	invLine = strings.TrimSpace(invLine)
+	if strings.HasPrefix(invLine, "error:") {
+		return fmt.Errorf("peer rejected getblocks: %s", invLine)
+	}
+	var hashes []string
+	if err := json.Unmarshal([]byte(invLine), &hashes); err != nil {
+		return fmt.Errorf("cannot parse inv from peer: %v", err)
+	}
+
+	if len(hashes) == 0 {
+		fmt.Printf("\033[33mPeer %s has nothing new, skipping sync\033[0m\n", peerAddr)
+	} else {
+		fmt.Printf("\033[36mPeer %s advertised %d block(s) via inv\033[0m\n", peerAddr, len(hashes))
+		totalSynced := 0
+
+		for _, hash := range hashes {
+			if _, ok := bc.IndexOfHash(hash); ok {
+				continue // already have it
+			}
+
+			fmt.Fprintf(conn, "getdata\n")
+			fmt.Fprintf(conn, "%s\n", hash)
+			blockLine, err := reader.ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("cannot read block %s from peer: %v", hash, err)
+			}
+			blockLine = strings.TrimSpace(blockLine)
+			if strings.HasPrefix(blockLine, "error:") {
+				return fmt.Errorf("peer could not serve block %s: %s", hash, blockLine)
+			}
+			var block chain.Block
+			if err := json.Unmarshal([]byte(blockLine), &block); err != nil {
+				return fmt.Errorf("cannot parse block %s from peer: %v", hash, err)
+			}
+
+			if len(bc.Chain) == 0 && block.Index == 0 {
+				bc.Chain = append(bc.Chain, block)
+				bc.RebuildHashIndex()
+				fmt.Printf("\033[32mAccepted genesis block from peer %s\033[0m\n", peerAddr)
+				totalSynced++
+				continue
+			}
+
+			if block.Index < len(bc.Chain) {
+				// The peer's block at this height isn't one we already
+				// hold (checked above), so our chain forked here: drop
+				// everything from this height up before appending, since
+				// the rest of the inv extends the peer's side of the fork.
+				fmt.Printf("\033[33mReorg: rolling back local chain from height %d to %d to follow peer %s\033[0m\n", len(bc.Chain)-1, block.Index-1, peerAddr)
+				bc.Chain = bc.Chain[:block.Index]
+				bc.RebuildHashIndex()
+			}
+
+			dynDiff := bc.GetDynamicDifficulty()
+			if bc.AddBlockSkipPow(block, dynDiff, true) { // skip PoW validation during sync
+				fmt.Printf("\033[32mSynced block %d from peer %s\033[0m\n", block.Index, peerAddr)
+				totalSynced++
+			} else {
+				fmt.Printf("\033[31mBlock %d validation failed\033[0m\n", block.Index)
+				return fmt.Errorf("failed to validate block %d from peer %s", block.Index, peerAddr)
+			}
+		}
+
+		if err := bc.SaveToFile(chainFile); err != nil {
+			return fmt.Errorf("failed to save synced blockchain: %v", err)
+		}
+		if idx != nil && totalSynced > 0 {
+			idx.Rebuild(bc)
+			_ = idx.SaveToFile(utxoFile)
+		}
+		if hidx != nil && totalSynced > 0 {
+			hidx.Rebuild(bc)
+			_ = hidx.SaveToFile(historyFile)
+		}
+		fmt.Printf("\033[32mSuccessfully synced %d blocks from peer %s\033[0m\n", totalSynced, peerAddr)
+	}
+
+	// Get peer's peer list and add them to our list
+	fmt.Fprintf(conn, "getpeers\n")
+	var peerPeers []string
+	if err := json.NewDecoder(reader).Decode(&peerPeers); err != nil {
+		fmt.Printf("\033[33mWarning: could not get peer list from %s: %v\033[0m\n", peerAddr, err)
+	} else {
+		for _, pp := range peerPeers {
+			if pp != "" && pp != peerAddr { // don't add self
+				pm.AddPeer(pp)
+				fmt.Printf("\033[32mAdded peer %s from peer %s\033[0m\n", pp, peerAddr)
+			}
+		}
+	}
+
+	return nil
+}
+
+// SyncWithPeers attempts to sync blockchain with all known peers
+func SyncWithPeers(pm *PeerManager, bc *chain.Blockchain, chainFile string, idx *chain.BalanceIndex, utxoFile string, hidx *chain.HistoryIndex, historyFile string) {
+	peers := pm.GetPeers()
+	fmt.Printf("\033[36msyncWithPeers called with %d peers\033[0m\n", len(peers))
+	if len(peers) == 0 {
+		return
+	}
+
+	fmt.Printf("\033[36mAttempting to sync with %d peers...\033[0m\n", len(peers))
+	synced := false
+
+	for _, peer := range peers {
+		if err := SyncWithPeer(peer.Address, bc, pm, chainFile, idx, utxoFile, hidx, historyFile); err != nil {
+			fmt.Printf("\033[31mSync with peer %s failed: %v\033[0m\n", peer.Address, err)
+		} else {
+			synced = true
+		}
+	}
+
+	if synced {
+		fmt.Printf("\033[32mBlockchain sync complete. New height: %d\033[0m\n", len(bc.Chain)-1)
+	}
+}
@@ -0,0 +1,139 @@
+package p2p
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+// TLSEnabled, TLSSkipVerify and PeerPinnedCert mirror chain.SetPowMode's
+// package-level switch: set once from CLI flags in cmd/owonero-daemon's
+// main, then read by DialPeer whenever SyncWithPeer(s) dials a peer.
+var (
+	TLSEnabled     bool
+	TLSSkipVerify  bool
+	PeerPinnedCert string
+)
+
+// LoadOrGenerateTLSConfig loads an existing certPath/keyPath pair, or
+// generates a fresh ECDSA P-256 self-signed certificate (valid 10 years,
+// SANs covering every local interface IP plus the machine's hostname) and
+// persists it, so a plain "daemon -d --tls" run never has to be handed a
+// cert by the operator. runDaemon wraps its listener with this config via
+// tls.NewListener instead of serving plaintext, protecting sendtx payloads
+// and blockchain responses from MITM on untrusted networks.
+func LoadOrGenerateTLSConfig(certPath, keyPath string) (*tls.Config, error) {
+	if _, err := os.Stat(certPath); err == nil {
+		if _, err := os.Stat(keyPath); err == nil {
+			cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+			if err != nil {
+				return nil, fmt.Errorf("cannot load %s/%s: %v", certPath, keyPath, err)
+			}
+			return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+		}
+	}
+
+	certPem, keyPem, err := generateSelfSignedCert()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(certPath, certPem, 0644); err != nil {
+		return nil, fmt.Errorf("cannot persist %s: %v", certPath, err)
+	}
+	if err := os.WriteFile(keyPath, keyPem, 0600); err != nil {
+		return nil, fmt.Errorf("cannot persist %s: %v", keyPath, err)
+	}
+
+	tlsCert, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{tlsCert}}, nil
+}
+
+// generateSelfSignedCert builds a 10-year ECDSA P-256 certificate whose
+// SANs cover every IP address bound to a local interface plus the
+// machine's hostname, so peers reaching this node by any of its usual
+// addresses still validate (when not using --tls-skip-verify/--peer-cert
+// pinning).
+func generateSelfSignedCert() (certPem, keyPem []byte, err error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot generate TLS key: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "owonero-daemon", Organization: []string{"Owonero"}},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok {
+				template.IPAddresses = append(template.IPAddresses, ipNet.IP)
+			}
+		}
+	}
+
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot create certificate: %v", err)
+	}
+	certPem = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes})
+
+	privBytes, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot marshal TLS private key: %v", err)
+	}
+	keyPem = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privBytes})
+
+	return certPem, keyPem, nil
+}
+
+// DialPeer opens a connection to a daemon peer, speaking TLS when the node
+// was started with --tls and falling back to plain TCP otherwise. It is the
+// single place SyncWithPeer and the sendtx/getchain client paths go through
+// so --tls-skip-verify and --peer-cert pinning apply uniformly.
+func DialPeer(addr string) (net.Conn, error) {
+	if !TLSEnabled {
+		return net.Dial("tcp", addr)
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: TLSSkipVerify}
+	if PeerPinnedCert != "" {
+		pemBytes, err := os.ReadFile(PeerPinnedCert)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read pinned peer cert %s: %v", PeerPinnedCert, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemBytes) {
+			return nil, fmt.Errorf("no certificates found in %s", PeerPinnedCert)
+		}
+		cfg.RootCAs = pool
+		cfg.InsecureSkipVerify = false
+	}
+	return tls.Dial("tcp", addr, cfg)
+}
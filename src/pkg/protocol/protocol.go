@@ -0,0 +1,188 @@
+// Package protocol implements the daemon's binary mining protocol: a
+// length-prefixed, typed-message framing meant to replace the line-based
+// JSON text protocol (see the daemon's handleConn) for high-frequency
+// miner traffic, where a newline-delimited JSON blob per share wastes
+// bandwidth and gives the server no cheap way to push a message without
+// the client asking first.
+package protocol
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
+)
+
+// Version is this package's wire protocol version, exchanged in the
+// opening Hello/HelloAck handshake so a client and daemon running
+// incompatible revisions refuse each other instead of misparsing frames.
+const Version = 1
+
+// MsgType identifies a frame's payload, the binary protocol's analogue of
+// the "method" field the JSON-RPC and Stratum v1 text protocols dispatch
+// on.
+type MsgType byte
+
+const (
+	MsgHello MsgType = iota + 1
+	MsgHelloAck
+	MsgSubscribeMiner
+	MsgSubscribeAck
+	MsgNewJob
+	MsgSetDifficulty
+	MsgSubmitShare
+	MsgShareResult
+	MsgSubmitBlock
+	MsgSubmitBlockResult
+	MsgSendTx
+	MsgSendTxResult
+	MsgGetChain
+	MsgChain
+	MsgError
+)
+
+// maxFrameSize bounds a single frame's payload, the binary protocol's
+// equivalent of bufio.Scanner's line-length cap on the text protocols --
+// without it a bogus length prefix could make ReadFrame try to allocate
+// gigabytes for one message.
+const maxFrameSize = 16 * 1024 * 1024 // 16MiB, comfortably more than one block's JSON
+
+// WriteFrame marshals payload to JSON and writes it as
+// [4-byte big-endian length][1-byte type][payload], one write per message
+// instead of a text protocol's newline-delimited line.
+func WriteFrame(w io.Writer, msgType MsgType, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("protocol: marshal payload: %v", err)
+	}
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header[:4], uint32(len(body)))
+	header[4] = byte(msgType)
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("protocol: write header: %v", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("protocol: write payload: %v", err)
+	}
+	return nil
+}
+
+// ReadFrame blocks until it can read one complete frame from r, returning
+// its type and raw JSON payload for the caller to unmarshal into whatever
+// struct that MsgType implies.
+func ReadFrame(r io.Reader) (MsgType, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length > maxFrameSize {
+		return 0, nil, fmt.Errorf("protocol: frame of %d bytes exceeds %d byte limit", length, maxFrameSize)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return MsgType(header[4]), body, nil
+}
+
+// Hello is the client's opening handshake frame.
+type Hello struct {
+	Version int `json:"version"`
+}
+
+// HelloAck is the daemon's handshake reply. SessionID scopes every later
+// frame on this connection, the same role Stratum v1's extranonce1 plays,
+// but is assigned up front so GetChain/SendTx can share it too instead of
+// needing mining.subscribe first.
+type HelloAck struct {
+	Version   int    `json:"version"`
+	SessionID string `json:"session_id"`
+}
+
+// SubscribeMiner registers wallet as this session's payout address.
+type SubscribeMiner struct {
+	Wallet string `json:"wallet"`
+}
+
+// SubscribeAck hands back the extranonce1 a miner folds into its nonce
+// search space, same role as Stratum v1's mining.subscribe reply.
+type SubscribeAck struct {
+	ExtraNonce1 string `json:"extranonce1"`
+	Difficulty  int    `json:"difficulty"`
+}
+
+// NewJob is a server-pushed mining template, the binary protocol's
+// analogue of Stratum v1's mining.notify. JobID lets SubmitShare be
+// checked against the job it was actually mined for, so a share submitted
+// against a template the daemon has since abandoned can be rejected as
+// stale instead of silently re-derived from the current tip.
+type NewJob struct {
+	JobID       string `json:"job_id"`
+	PrevHash    string `json:"prev_hash"`
+	Height      int    `json:"height"`
+	ExtraNonce1 string `json:"extranonce1"`
+	Difficulty  int    `json:"difficulty"`
+	CleanJobs   bool   `json:"clean_jobs"`
+}
+
+// SetDifficulty is a server-pushed vardiff retarget.
+type SetDifficulty struct {
+	Difficulty int `json:"difficulty"`
+}
+
+// SubmitShare is a miner's solution attempt against a specific JobID.
+type SubmitShare struct {
+	JobID       string `json:"job_id"`
+	Nonce       int    `json:"nonce"`
+	ExtraNonce2 string `json:"extranonce2"`
+}
+
+// ShareResult answers a SubmitShare.
+type ShareResult struct {
+	Accepted bool   `json:"accepted"`
+	Stale    bool   `json:"stale"`
+	Error    string `json:"error,omitempty"`
+}
+
+// SubmitBlock carries a fully assembled block for direct submission,
+// mirroring the legacy protocol's submitblock command.
+type SubmitBlock struct {
+	Block chain.Block `json:"block"`
+}
+
+// SubmitBlockResult answers a SubmitBlock.
+type SubmitBlockResult struct {
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// SendTx carries a signed transaction for mempool submission, mirroring
+// the legacy protocol's sendtx command.
+type SendTx struct {
+	Tx chain.Transaction `json:"tx"`
+}
+
+// SendTxResult answers a SendTx.
+type SendTxResult struct {
+	Accepted bool   `json:"accepted"`
+	TxID     string `json:"txid,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// GetChain requests the full chain, mirroring the legacy protocol's
+// getchain command.
+type GetChain struct{}
+
+// ChainMsg answers a GetChain.
+type ChainMsg struct {
+	Blocks []chain.Block `json:"blocks"`
+}
+
+// ErrorMsg is a generic error frame, sent when a request can't be parsed
+// well enough to answer with its own typed result (e.g. malformed JSON).
+type ErrorMsg struct {
+	Error string `json:"error"`
+}
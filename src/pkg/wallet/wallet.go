@@ -1,4 +1,8 @@
-package main
+// Package wallet manages keypairs and address-local operations
+// (balance lookups, signed transaction construction) on top of pkg/chain,
+// so the wallet TUI, miner, and daemon can all load/use a wallet without
+// pulling in each other's JSON-RPC or TUI code.
+package wallet
 
 import (
 	"crypto/ecdsa"
@@ -9,7 +13,8 @@ import (
 	"encoding/pem"
 	"fmt"
 	"os"
-	"time"
+
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
 )
 
 // Wallet stores address, public key, and private key (ECDSA)
@@ -19,8 +24,8 @@ type Wallet struct {
 	PrivKey string `json:"privkey"`
 }
 
-// loadOrCreateWallet loads wallet from file or creates a new one if not found
-func loadOrCreateWallet(path string) (Wallet, error) {
+// LoadOrCreateWallet loads wallet from file or creates a new one if not found
+func LoadOrCreateWallet(path string) (Wallet, error) {
 	if _, err := os.Stat(path); err == nil {
 		data, err := os.ReadFile(path)
 		if err != nil {
@@ -32,9 +37,6 @@ func loadOrCreateWallet(path string) (Wallet, error) {
 		}
 		return w, nil
 	}
-	// Generate unique address
-	address := fmt.Sprintf("OWO%016x", time.Now().UnixNano())
-
 	// Generate ECDSA keys
 	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
@@ -52,6 +54,14 @@ func loadOrCreateWallet(path string) (Wallet, error) {
 	}
 	pubPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
 
+	// The address is derived from the key itself (see chain.AddrFromPubKey)
+	// instead of a timestamp, so VerifyTransactionSignature can actually
+	// bind a signed transaction's From to the key that signed it.
+	address, err := chain.AddrFromPubKey(string(pubPem))
+	if err != nil {
+		return Wallet{}, fmt.Errorf("failed to derive address: %v", err)
+	}
+
 	w := Wallet{
 		Address: address,
 		PubKey:  string(pubPem),
@@ -64,32 +74,19 @@ func loadOrCreateWallet(path string) (Wallet, error) {
 	return w, nil
 }
 
-// getBalance calculates wallet balance by scanning the blockchain
-func getBalance(w Wallet, bc *Blockchain) int {
-	balance := 0
-	for _, blk := range bc.Chain {
-		for _, tx := range blk.Transactions {
-			if tx.To == w.Address {
-				balance += tx.Amount
-			}
-			if tx.From == w.Address {
-				balance -= tx.Amount
-			}
-		}
-	}
-	return balance
+// GetBalance looks up wallet's balance in idx, which the daemon keeps
+// incrementally up to date instead of rescanning every block on every call
+// (see chain.BuildBalanceIndex).
+func GetBalance(w Wallet, idx *chain.BalanceIndex) int {
+	return int(idx.Balance(w.Address))
 }
 
 // CreateSignedTransaction creates and signs a transaction from this wallet
-func (w *Wallet) CreateSignedTransaction(to string, amount int) (*Transaction, error) {
-	tx := &Transaction{
-		From:   w.Address,
-		To:     to,
-		Amount: amount,
-	}
-	err := SignTransaction(tx, w.PrivKey)
-	if err != nil {
+func (w *Wallet) CreateSignedTransaction(to string, amount int) (*chain.Transaction, error) {
+	tx := chain.NewTransaction(w.Address, to, amount)
+	tx.PubKey = w.PubKey
+	if err := chain.SignTransaction(&tx, w.PrivKey); err != nil {
 		return nil, err
 	}
-	return tx, nil
+	return &tx, nil
 }
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
+	"github.com/tosterlolz/Owonero/src/pkg/p2p"
+	"github.com/tosterlolz/Owonero/src/pkg/wallet"
+)
+
+// JSON-RPC 2.0 HTTP API. Replaces the stateful getchain/getpeers/addpeer/
+// submitblock/submitshare line dialogue, which had no auth, no versioning,
+// and no guaranteed reply ordering when a connection was shared between
+// goroutines (see startMining's old submitter/share readers).
+
+const accessTokensFile = "access_tokens.json"
+
+// AccessToken is a Bytom-style bearer token: the raw secret is only shown
+// once at creation time, and what's persisted is its HMAC so a leaked
+// access_tokens.json can't be replayed to mint new tokens.
+type AccessToken struct {
+	Label     string    `json:"label"`
+	MAC       string    `json:"mac"` // hex HMAC-SHA256(secret) keyed by the server's local key
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type tokenStore struct {
+	key    []byte
+	tokens []AccessToken
+}
+
+func loadTokenStore() (*tokenStore, error) {
+	ts := &tokenStore{}
+	if data, err := os.ReadFile(".rpc_hmac_key"); err == nil {
+		ts.key = data
+	} else {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(".rpc_hmac_key", key, 0600); err != nil {
+			return nil, err
+		}
+		ts.key = key
+	}
+	if data, err := os.ReadFile(accessTokensFile); err == nil {
+		if err := json.Unmarshal(data, &ts.tokens); err != nil {
+			return nil, fmt.Errorf("cannot parse %s: %v", accessTokensFile, err)
+		}
+	}
+	return ts, nil
+}
+
+func (ts *tokenStore) save() error {
+	data, err := json.MarshalIndent(ts.tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(accessTokensFile, data, 0600)
+}
+
+func (ts *tokenStore) mac(secret string) string {
+	h := hmac.New(sha256.New, ts.key)
+	h.Write([]byte(secret))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// create mints a new token for the given scopes, persists its MAC, and
+// returns the raw secret (shown to the operator exactly once).
+func (ts *tokenStore) create(label string, scopes []string) (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(raw)
+	ts.tokens = append(ts.tokens, AccessToken{
+		Label:     label,
+		MAC:       ts.mac(secret),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err := ts.save(); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// authorize returns the matching AccessToken for a bearer secret, or false
+// if it's unknown.
+func (ts *tokenStore) authorize(secret string) (AccessToken, bool) {
+	mac := ts.mac(secret)
+	for _, t := range ts.tokens {
+		if hmac.Equal([]byte(t.MAC), []byte(mac)) {
+			return t, true
+		}
+	}
+	return AccessToken{}, false
+}
+
+// methodAllowed checks that the token's scopes cover the method's family
+// (the part of "family.method" before the dot).
+func methodAllowed(tok AccessToken, method string) bool {
+	family := strings.SplitN(method, ".", 2)[0]
+	for _, s := range tok.Scopes {
+		if s == family || s == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// rpcEnvelope is the uniform response shape for every method.
+type rpcEnvelope struct {
+	Status  string      `json:"status"` // "success" | "fail" | "error"
+	Data    interface{} `json:"data,omitempty"`
+	Message string      `json:"message,omitempty"`
+	Code    int         `json:"code,omitempty"`
+}
+
+type rpcRequest struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// rpcServer binds the method table to the blockchain/peer state so no
+// logic is duplicated against the legacy line handlers in daemon.go.
+type rpcServer struct {
+	bc     *chain.Blockchain
+	pm     *p2p.PeerManager
+	tokens *tokenStore
+	mp     *Mempool
+	idx    *chain.BalanceIndex
+	hidx   *chain.HistoryIndex
+}
+
+func newRPCServer(bc *chain.Blockchain, pm *p2p.PeerManager, tokens *tokenStore, mp *Mempool, idx *chain.BalanceIndex, hidx *chain.HistoryIndex) *rpcServer {
+	return &rpcServer{bc: bc, pm: pm, tokens: tokens, mp: mp, idx: idx, hidx: hidx}
+}
+
+func writeEnvelope(w http.ResponseWriter, env rpcEnvelope) {
+	w.Header().Set("Content-Type", "application/json")
+	if env.Status == "error" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	_ = json.NewEncoder(w).Encode(env)
+}
+
+// authMiddleware enforces a bearer token with a per-token method allowlist
+// before a request reaches the method dispatcher.
+func (s *rpcServer) authMiddleware(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		writeEnvelope(w, rpcEnvelope{Status: "error", Message: "missing bearer token", Code: http.StatusUnauthorized})
+		return
+	}
+	secret := strings.TrimPrefix(auth, "Bearer ")
+	tok, ok := s.tokens.authorize(secret)
+	if !ok {
+		writeEnvelope(w, rpcEnvelope{Status: "error", Message: "invalid token", Code: http.StatusUnauthorized})
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeEnvelope(w, rpcEnvelope{Status: "error", Message: "cannot read request body", Code: http.StatusBadRequest})
+		return
+	}
+	var req rpcRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeEnvelope(w, rpcEnvelope{Status: "error", Message: "invalid json-rpc request", Code: http.StatusBadRequest})
+		return
+	}
+	if !methodAllowed(tok, req.Method) {
+		writeEnvelope(w, rpcEnvelope{Status: "error", Message: "token not scoped for " + req.Method, Code: http.StatusForbidden})
+		return
+	}
+	s.dispatch(w, req)
+}
+
+func (s *rpcServer) dispatch(w http.ResponseWriter, req rpcRequest) {
+	switch req.Method {
+	case "chain.getChain":
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: s.bc})
+	case "chain.getHeight":
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: len(s.bc.Chain) - 1})
+	case "chain.getHead":
+		head := s.bc.Chain[len(s.bc.Chain)-1]
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: head})
+	case "chain.getBlockByHeight":
+		var p struct {
+			Height int `json:"height"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		if p.Height < 0 || p.Height >= len(s.bc.Chain) {
+			writeEnvelope(w, rpcEnvelope{Status: "fail", Message: "height out of range"})
+			return
+		}
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: s.bc.Chain[p.Height]})
+	case "chain.getBlock":
+		var p struct {
+			Hash string `json:"hash"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		for _, b := range s.bc.Chain {
+			if b.Hash == p.Hash {
+				writeEnvelope(w, rpcEnvelope{Status: "success", Data: b})
+				return
+			}
+		}
+		writeEnvelope(w, rpcEnvelope{Status: "fail", Message: "block not found"})
+	case "chain.getBalance":
+		var p struct {
+			Address string `json:"address"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: p2p.GetWalletInfo(p.Address, s.bc)})
+	case "chain.getHistory":
+		var hreq HistoryRequest
+		_ = json.Unmarshal(req.Params, &hreq)
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: historyResponse(s.bc, s.hidx, hreq)})
+	case "tx.sendRaw":
+		var tx chain.Transaction
+		_ = json.Unmarshal(req.Params, &tx)
+		if err := s.mp.Insert(tx, s.bc, s.idx, s.hidx); err != nil {
+			writeEnvelope(w, rpcEnvelope{Status: "fail", Message: err.Error()})
+			return
+		}
+		go gossipTx(s.pm, tx, "")
+		writeEnvelope(w, rpcEnvelope{Status: "success"})
+	case "tx.getRaw":
+		// Checks the mempool first, then falls back to scanning mined
+		// blocks (same lookup web_stats' GET /tx/<hash> does), so this
+		// covers both a still-pending and an already-confirmed txid.
+		var p struct {
+			TxID string `json:"txid"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		if tx, ok := s.mp.RawTx(p.TxID); ok {
+			writeEnvelope(w, rpcEnvelope{Status: "success", Data: tx})
+			return
+		}
+		for _, blk := range s.bc.Chain {
+			for _, tx := range blk.Transactions {
+				if txID(tx) == p.TxID {
+					writeEnvelope(w, rpcEnvelope{Status: "success", Data: tx})
+					return
+				}
+			}
+		}
+		writeEnvelope(w, rpcEnvelope{Status: "fail", Message: "unknown txid"})
+	case "tx.pending":
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: s.mp.All()})
+	case "tx.getRawMempool":
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: s.mp.RawMempool()})
+	case "tx.getMempoolEntry":
+		var p struct {
+			TxID string `json:"txid"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		entry, ok := s.mp.Entry(p.TxID)
+		if !ok {
+			writeEnvelope(w, rpcEnvelope{Status: "fail", Message: "unknown txid"})
+			return
+		}
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: entry})
+	case "tx.resend":
+		var p struct {
+			TxID string `json:"txid"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		if _, ok := s.mp.Resend(p.TxID, s.pm); !ok {
+			writeEnvelope(w, rpcEnvelope{Status: "fail", Message: "unknown txid"})
+			return
+		}
+		writeEnvelope(w, rpcEnvelope{Status: "success"})
+	case "admin.removeTx":
+		// Its own "admin" scope family, unlike the other tx.* methods
+		// above, since removing a pending transaction is destructive and
+		// shouldn't be reachable with a token only meant to read/submit.
+		var p struct {
+			TxID string `json:"txid"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		s.mp.Remove(p.TxID)
+		writeEnvelope(w, rpcEnvelope{Status: "success"})
+	case "mining.getWork":
+		prev := s.bc.Chain[len(s.bc.Chain)-1]
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: map[string]interface{}{
+			"prev_hash":  prev.Hash,
+			"height":     prev.Index + 1,
+			"difficulty": s.bc.GetDynamicDifficulty(),
+		}})
+	case "mining.submitBlock":
+		var blk chain.Block
+		_ = json.Unmarshal(req.Params, &blk)
+		dynDiff := s.bc.GetDynamicDifficulty()
+		if s.bc.AddBlock(blk, dynDiff) {
+			_ = s.bc.SaveToFile(blockchainFile)
+			s.idx.ApplyBlock(blk)
+			_ = s.idx.SaveToFile(utxoFile)
+			s.hidx.ApplyBlock(blk)
+			_ = s.hidx.SaveToFile(historyFile)
+			go gossipBlock(s.pm, blk.Hash, "")
+			writeEnvelope(w, rpcEnvelope{Status: "success"})
+		} else {
+			writeEnvelope(w, rpcEnvelope{Status: "fail", Message: "block invalid"})
+		}
+	case "mining.getHashrate":
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: map[string]int{"active_miners": s.pm.ActiveMinerCount()}})
+	case "mining.makeDAG":
+		var p struct {
+			Epoch int `json:"epoch"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		dag, err := chain.MakeDAG(p.Epoch)
+		if err != nil {
+			writeEnvelope(w, rpcEnvelope{Status: "error", Message: err.Error()})
+			return
+		}
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: map[string]interface{}{
+			"epoch":      dag.Epoch,
+			"seed":       hex.EncodeToString(dag.Seed[:]),
+			"cache_size": chain.CacheSize,
+		}})
+	case "mining.startAutoDAG":
+		epoch := chain.EpochOf(len(s.bc.Chain) - 1)
+		chain.StartAutoDAG(epoch)
+		writeEnvelope(w, rpcEnvelope{Status: "success"})
+	case "mining.stopAutoDAG":
+		chain.StopAutoDAG()
+		writeEnvelope(w, rpcEnvelope{Status: "success"})
+	case "net.peers":
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: s.pm.GetPeers()})
+	case "net.addPeer":
+		var p struct {
+			Address string `json:"address"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		s.pm.AddPeer(p.Address)
+		writeEnvelope(w, rpcEnvelope{Status: "success"})
+	case "net.isSyncing":
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: len(s.pm.GetPeers()) > 0})
+	case "wallet.create":
+		var p struct {
+			Path string `json:"path"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		if p.Path == "" {
+			p.Path = "wallet.json"
+		}
+		w2, err := wallet.LoadOrCreateWallet(p.Path)
+		if err != nil {
+			writeEnvelope(w, rpcEnvelope{Status: "error", Message: err.Error()})
+			return
+		}
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: w2.Address})
+	case "wallet.getBalance":
+		// Backed by the balance index instead of chain.getBalance's
+		// full-chain GetWalletInfo scan -- the fast path for a caller that
+		// only wants the spendable balance, not received/sent totals too.
+		var p struct {
+			Address string `json:"address"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: getBalanceWithMempool(p.Address, s.idx, s.mp)})
+	case "wallet.list":
+		writeEnvelope(w, rpcEnvelope{Status: "success", Data: []string{}})
+	case "wallet.export":
+		writeEnvelope(w, rpcEnvelope{Status: "fail", Message: "export disabled over rpc"})
+	default:
+		writeEnvelope(w, rpcEnvelope{Status: "error", Message: "unknown method: " + req.Method, Code: http.StatusNotFound})
+	}
+}
+
+// listenAndServe starts the JSON-RPC HTTP listener on a single /rpc path.
+func (s *rpcServer) listenAndServe(port int) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rpc", s.authMiddleware)
+	fmt.Printf("\033[32mJSON-RPC 2.0 API listening on :%d/rpc\033[0m\n", port)
+	return http.ListenAndServe(":"+strconv.Itoa(port), mux)
+}
+
+// cliCreateToken implements `owonero token create --scope mining,chain`.
+func cliCreateToken(args []string) {
+	label := "cli"
+	var scopes []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--scope":
+			if i+1 < len(args) {
+				scopes = strings.Split(args[i+1], ",")
+				i++
+			}
+		case "--label":
+			if i+1 < len(args) {
+				label = args[i+1]
+				i++
+			}
+		}
+	}
+	if len(scopes) == 0 {
+		fmt.Println("error: --scope is required, e.g. --scope mining,chain")
+		os.Exit(1)
+	}
+	ts, err := loadTokenStore()
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+	secret, err := ts.create(label, scopes)
+	if err != nil {
+		fmt.Printf("error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\033[32mToken created (scopes: %s)\033[0m\n%s\n", strings.Join(scopes, ","), secret)
+	fmt.Println("\033[33mThis secret is only shown once; store it now.\033[0m")
+}
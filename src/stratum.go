@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
+	"github.com/tosterlolz/Owonero/src/pkg/p2p"
+)
+
+// Stratum v1 JSON-RPC-over-TCP subsystem for the pool daemon. Replaces the
+// old submitshare/submitblock line protocol, which raced the submitter and
+// share goroutines over one shared bufio.Reader.
+
+// StratumRequest is a JSON-RPC 2.0-ish request as used by Stratum v1 (no
+// "jsonrpc" field, id may be null for server-pushed notifications).
+type StratumRequest struct {
+	ID     interface{}   `json:"id"`
+	Method string        `json:"method"`
+	Params []interface{} `json:"params"`
+}
+
+// StratumResponse mirrors the shape miners expect back for a request.
+type StratumResponse struct {
+	ID     interface{} `json:"id"`
+	Result interface{} `json:"result"`
+	Error  interface{} `json:"error"`
+}
+
+// pplnsShare is one accepted share inside the PPLNS window.
+type pplnsShare struct {
+	Wallet     string
+	Difficulty int
+	Timestamp  time.Time
+}
+
+const pplnsWindowSize = 5000
+
+// miningJob is a cached, canonical block template: the exact prev hash,
+// timestamp and FINAL transaction set (PPLNS payouts, finder fee and the
+// mempool txs pulled for this job) a share is scored against. The miner
+// hashes over block as-is, so acceptShare reconstructs the identical
+// candidate instead of re-deriving one from whatever the chain tip or
+// PPLNS window happen to look like when the share arrives -- otherwise a
+// winning nonce would be mined against one transaction set and submitted
+// against another, and validateBlock's difficulty check would only pass
+// by chance.
+type miningJob struct {
+	block     chain.Block
+	bits      int
+	createdAt time.Time
+	pending   []chain.Transaction // mempool txs baked into block, to evict from mp once it's added
+}
+
+// jobExpiry bounds how long a job stays valid; acceptShare rejects shares
+// against a job older than this as stale, the same way it rejects shares
+// against a job id it doesn't recognize at all.
+const jobExpiry = 2 * time.Minute
+
+// StratumServer runs the pool side of the protocol: it tracks connected
+// workers, assigns extranonce1 values, runs vardiff, and keeps the PPLNS
+// share ledger used to build payout outputs when a block is found.
+type StratumServer struct {
+	bc   *chain.Blockchain
+	pm   *p2p.PeerManager
+	port int
+	mp   *Mempool
+	idx  *chain.BalanceIndex
+	hidx *chain.HistoryIndex
+
+	mutex   sync.Mutex
+	workers map[string]*stratumWorker
+	window  []pplnsShare // ring buffer, oldest first
+	jobSeq  int64
+	jobs    map[string]*miningJob
+}
+
+// stratumWorker is per-connection state for a subscribed miner.
+type stratumWorker struct {
+	conn         net.Conn
+	enc          *json.Encoder
+	extranonce1  string
+	wallet       string
+	difficulty   int
+	shareTimes   []time.Time // recent accept timestamps, used for vardiff
+	currentJobID string
+}
+
+func newStratumServer(bc *chain.Blockchain, pm *p2p.PeerManager, port int, mp *Mempool, idx *chain.BalanceIndex, hidx *chain.HistoryIndex) *StratumServer {
+	s := &StratumServer{
+		bc:      bc,
+		pm:      pm,
+		port:    port,
+		mp:      mp,
+		idx:     idx,
+		hidx:    hidx,
+		workers: make(map[string]*stratumWorker),
+		jobs:    make(map[string]*miningJob),
+	}
+	s.loadShareLedger()
+	return s
+}
+
+// loadShareLedger restores the PPLNS window from shareLedgerFile, so a
+// daemon restart doesn't wipe miner credit mid-round.
+func (s *StratumServer) loadShareLedger() {
+	data, err := os.ReadFile(shareLedgerFile)
+	if err != nil {
+		return // no ledger yet, nothing to restore
+	}
+	var window []pplnsShare
+	if err := json.Unmarshal(data, &window); err != nil {
+		return
+	}
+	s.window = window
+}
+
+// saveShareLedgerLocked persists the PPLNS window to shareLedgerFile.
+// Caller must hold s.mutex.
+func (s *StratumServer) saveShareLedgerLocked() {
+	data, err := json.Marshal(s.window)
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(shareLedgerFile, data, 0644)
+}
+
+// PoolStats summarizes the live PPLNS window and connected workers, for
+// the getpoolstats daemon command.
+type PoolStats struct {
+	ConnectedWorkers int   `json:"connected_workers"`
+	WindowShares     int   `json:"window_shares"`
+	WindowDifficulty int64 `json:"window_difficulty"`
+	DistinctMiners   int   `json:"distinct_miners"`
+}
+
+// Stats reports the current pool state.
+func (s *StratumServer) Stats() PoolStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	wallets := make(map[string]bool)
+	var totalDiff int64
+	for _, sh := range s.window {
+		wallets[sh.Wallet] = true
+		totalDiff += int64(sh.Difficulty)
+	}
+	return PoolStats{
+		ConnectedWorkers: len(s.workers),
+		WindowShares:     len(s.window),
+		WindowDifficulty: totalDiff,
+		DistinctMiners:   len(wallets),
+	}
+}
+
+// Payouts previews what each wallet would currently earn from a block
+// reward of reward, per the live PPLNS window, for the getpayouts daemon
+// command -- the same distribution finalizeBlock uses when a block is
+// actually found.
+func (s *StratumServer) Payouts(reward int) map[string]int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return pplnsPayouts(s.window, reward)
+}
+
+// run starts the Stratum listener and the job broadcaster. It blocks, so
+// callers should invoke it in a goroutine.
+func (s *StratumServer) run() {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		log.Fatalf("stratum: failed to listen: %v", err)
+	}
+	defer ln.Close()
+	fmt.Printf("\033[32mStratum v1 listening on :%d\033[0m\n", s.port)
+
+	go s.broadcastJobsLoop()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Println("stratum: accept error:", err)
+			continue
+		}
+		go s.handleWorker(conn)
+	}
+}
+
+// broadcastJobsLoop pushes mining.notify with clean_jobs=true whenever the
+// chain head changes, so every connected miner works on the current tip.
+func (s *StratumServer) broadcastJobsLoop() {
+	lastHead := ""
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		if len(s.bc.Chain) == 0 {
+			continue
+		}
+		head := s.bc.Chain[len(s.bc.Chain)-1].Hash
+		if head == lastHead {
+			continue
+		}
+		lastHead = head
+		s.mutex.Lock()
+		for _, w := range s.workers {
+			s.sendJob(w, true)
+		}
+		s.mutex.Unlock()
+	}
+}
+
+func (s *StratumServer) handleWorker(conn net.Conn) {
+	defer conn.Close()
+
+	extranonce1 := make([]byte, 4)
+	_, _ = rand.Read(extranonce1)
+
+	worker := &stratumWorker{
+		conn:        conn,
+		enc:         json.NewEncoder(conn),
+		extranonce1: hex.EncodeToString(extranonce1),
+		difficulty:  1,
+	}
+
+	reader := bufio.NewScanner(conn)
+	for reader.Scan() {
+		line := strings.TrimSpace(reader.Text())
+		if line == "" {
+			continue
+		}
+		var req StratumRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			s.reply(worker, nil, nil, fmt.Sprintf("invalid json-rpc: %v", err))
+			continue
+		}
+
+		switch req.Method {
+		case "mining.subscribe":
+			s.mutex.Lock()
+			s.workers[worker.extranonce1] = worker
+			s.mutex.Unlock()
+			s.reply(worker, req.ID, []interface{}{worker.extranonce1}, nil)
+
+		case "mining.authorize":
+			if len(req.Params) == 0 {
+				s.reply(worker, req.ID, false, "missing wallet address")
+				continue
+			}
+			wallet, _ := req.Params[0].(string)
+			worker.wallet = wallet
+			s.reply(worker, req.ID, true, nil)
+			s.sendDifficulty(worker)
+			s.sendJob(worker, true)
+
+		case "mining.submit":
+			ok, errMsg := s.acceptShare(worker, req.Params)
+			s.reply(worker, req.ID, ok, errMsg)
+
+		default:
+			s.reply(worker, req.ID, nil, "unknown method: "+req.Method)
+		}
+	}
+
+	s.mutex.Lock()
+	delete(s.workers, worker.extranonce1)
+	s.mutex.Unlock()
+}
+
+func (s *StratumServer) reply(w *stratumWorker, id interface{}, result interface{}, errVal interface{}) {
+	_ = w.enc.Encode(StratumResponse{ID: id, Result: result, Error: errVal})
+}
+
+// sendJob builds the FINAL candidate block -- PPLNS payouts from the
+// current window, a finder-fee coinbase for w, and pending mempool txs --
+// caches it under a fresh JobID, and issues mining.notify with its
+// MerkleRoot, Bits and Timestamp. The miner mines against exactly this
+// transaction set, so a winning nonce's hash is still valid once
+// acceptShare reassembles the same candidate and hands it to AddBlock;
+// nothing about the block's content is decided after the fact.
+func (s *StratumServer) sendJob(w *stratumWorker, cleanJobs bool) {
+	s.jobSeq++
+	jobID := fmt.Sprintf("%d", s.jobSeq)
+	prev := s.bc.Chain[len(s.bc.Chain)-1]
+	bits := s.bc.GetDynamicDifficulty()
+
+	s.mutex.Lock()
+	payouts := pplnsPayouts(s.window, 100)
+	s.mutex.Unlock()
+
+	txs := make([]chain.Transaction, 0, len(payouts)+2)
+	for payee, amt := range payouts {
+		if amt > 0 {
+			txs = append(txs, chain.NewTransaction("coinbase", payee, amt))
+		}
+	}
+
+	var pending []chain.Transaction
+	if s.mp != nil {
+		pending = s.mp.SelectForBlock(maxBlockTxs)
+		var feeTotal int
+		for _, tx := range pending {
+			feeTotal += tx.Fee
+		}
+		if feeTotal > 0 {
+			txs = append(txs, chain.NewTransaction("coinbase", w.wallet, feeTotal))
+		}
+	}
+	txs = append(txs, pending...)
+
+	candidate := chain.Block{
+		Index:        prev.Index + 1,
+		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+		Transactions: txs,
+		PrevHash:     prev.Hash,
+	}
+
+	s.mutex.Lock()
+	s.jobs[jobID] = &miningJob{block: candidate, bits: bits, createdAt: time.Now(), pending: pending}
+	s.pruneExpiredJobsLocked()
+	s.mutex.Unlock()
+	w.currentJobID = jobID
+
+	job := StratumRequest{
+		ID:     nil,
+		Method: "mining.notify",
+		Params: []interface{}{
+			jobID,
+			prev.Hash,
+			prev.Index + 1,
+			chain.MerkleRoot(txs),
+			candidate.Timestamp,
+			bits,
+			w.extranonce1,
+			cleanJobs,
+		},
+	}
+	_ = w.enc.Encode(job)
+}
+
+// pruneExpiredJobsLocked drops cached jobs older than jobExpiry so the
+// cache doesn't grow without bound across a long-running daemon. Caller
+// must hold s.mutex.
+func (s *StratumServer) pruneExpiredJobsLocked() {
+	for id, j := range s.jobs {
+		if time.Since(j.createdAt) > jobExpiry {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func (s *StratumServer) sendDifficulty(w *stratumWorker) {
+	_ = w.enc.Encode(StratumRequest{
+		ID:     nil,
+		Method: "mining.set_difficulty",
+		Params: []interface{}{w.difficulty},
+	})
+}
+
+// acceptShare validates a mining.submit against the job it claims to
+// solve (rejecting an unknown or expired JobID as stale before even
+// looking at the nonce), records it in the PPLNS window, runs vardiff,
+// and -- if the share also clears network difficulty -- assembles and
+// adds a real block crediting the window.
+func (s *StratumServer) acceptShare(w *stratumWorker, params []interface{}) (bool, interface{}) {
+	if len(params) < 3 {
+		return false, "expected [jobID, nonce, extranonce2]"
+	}
+	jobID, ok := params[0].(string)
+	if !ok {
+		return false, "bad job id"
+	}
+	nonceF, ok := params[1].(float64)
+	if !ok {
+		return false, "bad nonce"
+	}
+
+	s.mutex.Lock()
+	job, ok := s.jobs[jobID]
+	if ok && time.Since(job.createdAt) > jobExpiry {
+		delete(s.jobs, jobID)
+		ok = false
+	}
+	s.mutex.Unlock()
+	if !ok {
+		return false, "stale or unknown job id"
+	}
+
+	candidate := job.block
+	candidate.Nonce = int(nonceF)
+	candidate.Hash = chain.CalculateHash(candidate)
+
+	shareDiff := w.difficulty
+	if !strings.HasPrefix(candidate.Hash, strings.Repeat("0", shareDiff)) {
+		return false, "low-difficulty share"
+	}
+
+	s.mutex.Lock()
+	s.window = append(s.window, pplnsShare{Wallet: w.wallet, Difficulty: shareDiff, Timestamp: time.Now()})
+	if len(s.window) > pplnsWindowSize {
+		s.window = s.window[len(s.window)-pplnsWindowSize:]
+	}
+	s.saveShareLedgerLocked()
+	w.shareTimes = append(w.shareTimes, time.Now())
+	if len(w.shareTimes) > 20 {
+		w.shareTimes = w.shareTimes[len(w.shareTimes)-20:]
+	}
+	s.adjustVardiff(w)
+	s.mutex.Unlock()
+
+	if strings.HasPrefix(candidate.Hash, strings.Repeat("0", job.bits)) {
+		s.finalizeBlock(candidate, job.bits, job.pending)
+	}
+
+	return true, nil
+}
+
+// adjustVardiff retargets a worker's share difficulty towards ~10
+// shares/sec based on the observed rate over its last recorded shares.
+// Caller must hold s.mutex.
+func (s *StratumServer) adjustVardiff(w *stratumWorker) {
+	const targetSharesPerSec = 10.0
+	if len(w.shareTimes) < 2 {
+		return
+	}
+	span := w.shareTimes[len(w.shareTimes)-1].Sub(w.shareTimes[0]).Seconds()
+	if span <= 0 {
+		return
+	}
+	rate := float64(len(w.shareTimes)-1) / span
+	switch {
+	case rate > targetSharesPerSec*1.5 && w.difficulty < 7:
+		w.difficulty++
+		s.sendDifficulty(w)
+	case rate < targetSharesPerSec/1.5 && w.difficulty > 1:
+		w.difficulty--
+		s.sendDifficulty(w)
+	}
+}
+
+// finalizeBlock commits a job's already-mined candidate. Its transactions
+// (PPLNS payouts, finder fee, pending mempool txs) were fixed back when
+// sendJob built the job, and candidate.Hash was computed over exactly that
+// set, so nothing here rebuilds or reorders them -- doing so would
+// invalidate the PoW the miner actually solved. Caller must NOT hold
+// s.mutex.
+func (s *StratumServer) finalizeBlock(candidate chain.Block, difficulty int, pending []chain.Transaction) {
+	if s.bc.AddBlock(candidate, difficulty) {
+		_ = s.bc.SaveToFile(blockchainFile)
+		s.idx.ApplyBlock(candidate)
+		_ = s.idx.SaveToFile(utxoFile)
+		s.hidx.ApplyBlock(candidate)
+		_ = s.hidx.SaveToFile(historyFile)
+		go gossipBlock(s.pm, candidate.Hash, "")
+		if s.mp != nil {
+			for _, tx := range pending {
+				s.mp.Remove(txID(tx))
+			}
+		}
+		s.mutex.Lock()
+		windowLen := len(s.window)
+		s.mutex.Unlock()
+		fmt.Printf("\033[32mStratum: block %d found (PPLNS window=%d shares), included %d mempool txs\033[0m\n",
+			candidate.Index, windowLen, len(pending))
+	}
+}
+
+// pplnsPayouts distributes reward proportionally to each wallet's
+// difficulty-weighted share of the window.
+func pplnsPayouts(window []pplnsShare, reward int) map[string]int {
+	payouts := make(map[string]int)
+	var total int64
+	for _, sh := range window {
+		total += int64(sh.Difficulty)
+	}
+	if total == 0 {
+		return payouts
+	}
+	for _, sh := range window {
+		payouts[sh.Wallet] += int(int64(reward) * int64(sh.Difficulty) / total)
+	}
+	return payouts
+}
@@ -2,16 +2,23 @@ package main
 
 import (
 	"archive/zip"
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
 )
 
 type GitHubRelease struct {
@@ -24,44 +31,235 @@ type GitHubAsset struct {
 	BrowserDownloadURL string `json:"browser_download_url"`
 }
 
-func checkForUpdates() {
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
+// updateManifest is the signed description of the release asset for this
+// platform. checkForUpdates only trusts its SHA256 (and thus the asset
+// bytes it names) once manifest.json.sig verifies against the current
+// update keyring.
+type updateManifest struct {
+	Version string `json:"version"`
+	SHA256  string `json:"sha256"`
+	Asset   string `json:"asset"`
+	// MinDowngradeVersion is the oldest version this release will ever let
+	// a node roll back to; once a node has seen it, updateMinVersionFile
+	// enforces it against every future manifest, so a replayed old (but
+	// validly signed) manifest can't downgrade a node past a security fix.
+	MinDowngradeVersion string `json:"min_downgrade_version"`
+}
 
-	resp, err := client.Get("https://api.github.com/repos/tosterlolz/Owonero/releases/latest")
+// updateMinVersionFile persists the highest MinDowngradeVersion this node
+// has ever accepted, i.e. its anti-rollback floor.
+const updateMinVersionFile = "update_min_version.json"
+
+const (
+	updateHealthcheckArg     = "update-healthcheck"
+	updateHealthcheckTimeout = 10 * time.Second
+)
+
+// checkForUpdates fetches the latest release on channel ("stable" or
+// "beta"), verifies its signed manifest against the update keyring, and
+// installs it if it's newer than ver and not behind this node's
+// anti-rollback floor.
+func checkForUpdates(channel string) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	release, err := fetchLatestRelease(client, channel)
 	if err != nil {
 		fmt.Printf("\033[33mFailed to check for updates: %v\033[0m\n", err)
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("\033[33mUpdate check failed: HTTP %d\033[0m\n", resp.StatusCode)
+	assets := make(map[string]GitHubAsset, len(release.Assets))
+	for _, a := range release.Assets {
+		assets[a.Name] = a
+	}
+
+	assetName := fmt.Sprintf("owonero-%s-%s.zip", runtime.GOOS, runtime.GOARCH)
+	manifestName := assetName + ".manifest.json"
+	sigName := manifestName + ".sig"
+
+	asset, ok := assets[assetName]
+	if !ok {
+		fmt.Printf("\033[33mNo release asset for %s/%s\033[0m\n", runtime.GOOS, runtime.GOARCH)
+		return
+	}
+	manifestAsset, ok := assets[manifestName]
+	if !ok {
+		fmt.Println("\033[33mRelease has no signed manifest for this platform; refusing to update\033[0m")
+		return
+	}
+	sigAsset, ok := assets[sigName]
+	if !ok {
+		fmt.Println("\033[33mRelease manifest has no detached signature; refusing to update\033[0m")
 		return
 	}
 
-	var release GitHubRelease
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		fmt.Printf("\033[33mFailed to parse update info: %v\033[0m\n", err)
+	keys := loadUpdateKeyring()
+	if keyringAsset, ok := assets["keyring.json"]; ok {
+		if keyringSigAsset, ok := assets["keyring.json.sig"]; ok {
+			if newKeys, err := fetchAndApplyKeyring(client, keys, keyringAsset, keyringSigAsset); err != nil {
+				fmt.Printf("\033[33mIgnoring release keyring update: %v\033[0m\n", err)
+			} else {
+				keys = newKeys
+			}
+		} else {
+			fmt.Println("\033[33mRelease keyring has no detached signature; ignoring it\033[0m")
+		}
+	}
+
+	manifestRaw, err := fetchAsset(client, manifestAsset)
+	if err != nil {
+		fmt.Printf("\033[33mFailed to fetch update manifest: %v\033[0m\n", err)
+		return
+	}
+	sigRaw, err := fetchAsset(client, sigAsset)
+	if err != nil {
+		fmt.Printf("\033[33mFailed to fetch manifest signature: %v\033[0m\n", err)
+		return
+	}
+	var sig updateSignature
+	if err := json.Unmarshal(sigRaw, &sig); err != nil {
+		fmt.Printf("\033[33mFailed to parse manifest signature: %v\033[0m\n", err)
+		return
+	}
+	if err := verifyDetached(keys, manifestRaw, sig); err != nil {
+		fmt.Printf("\033[31mUpdate manifest failed signature verification: %v\033[0m\n", err)
 		return
 	}
 
-	latestVer := strings.TrimPrefix(release.TagName, "v")
-	if latestVer == ver {
-		fmt.Printf("\033[32mYou are running the latest version (%s)\033[0m\n", ver)
+	var manifest updateManifest
+	if err := json.Unmarshal(manifestRaw, &manifest); err != nil {
+		fmt.Printf("\033[33mFailed to parse update manifest: %v\033[0m\n", err)
+		return
+	}
+	if manifest.Asset != assetName {
+		fmt.Printf("\033[31mManifest names asset %q, expected %q; refusing to update\033[0m\n", manifest.Asset, assetName)
 		return
 	}
 
-	// Check if latest version is actually newer
-	if isVersionNewer(latestVer, ver) {
-		fmt.Printf("\033[33mNew version available: %s (current: %s)\033[0m\n", latestVer, ver)
-		fmt.Printf("\033[36mDownloading update...\033[0m\n")
-		downloadAndInstallUpdate(client, release)
-	} else {
+	if manifest.Version == ver || !isVersionNewer(manifest.Version, ver) {
 		fmt.Printf("\033[32mYou are running the latest version (%s)\033[0m\n", ver)
+		return
+	}
+	if floor := loadMinVersionFloor(); floor != "" && isVersionNewer(floor, manifest.Version) {
+		fmt.Printf("\033[31mRefusing update to %s: below this node's anti-rollback floor (%s)\033[0m\n", manifest.Version, floor)
+		return
+	}
+
+	fmt.Printf("\033[33mNew version available: %s (current: %s)\033[0m\n", manifest.Version, ver)
+	fmt.Println("\033[36mDownloading update...\033[0m")
+	applyUpdate(client, manifest, asset)
+}
+
+// fetchLatestRelease returns the latest release on channel: "stable" uses
+// GitHub's /releases/latest (which excludes prereleases), "beta" lists all
+// releases and takes the newest, prereleases included.
+func fetchLatestRelease(client *http.Client, channel string) (*GitHubRelease, error) {
+	if channel == "beta" {
+		resp, err := client.Get("https://api.github.com/repos/tosterlolz/Owonero/releases")
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+		var releases []GitHubRelease
+		if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+			return nil, err
+		}
+		if len(releases) == 0 {
+			return nil, fmt.Errorf("no releases published")
+		}
+		return &releases[0], nil
+	}
+
+	resp, err := client.Get("https://api.github.com/repos/tosterlolz/Owonero/releases/latest")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	var release GitHubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// fetchAsset downloads a release asset's raw bytes.
+func fetchAsset(client *http.Client, asset GitHubAsset) ([]byte, error) {
+	resp, err := client.Get(asset.BrowserDownloadURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// fetchAndApplyKeyring verifies keyringAsset against keys and, if it
+// verifies, returns the rotated key set and persists it to
+// updateKeyringFile.
+func fetchAndApplyKeyring(client *http.Client, keys []updateSigningKey, keyringAsset, sigAsset GitHubAsset) ([]updateSigningKey, error) {
+	raw, err := fetchAsset(client, keyringAsset)
+	if err != nil {
+		return nil, fmt.Errorf("fetching keyring.json: %v", err)
+	}
+	sigRaw, err := fetchAsset(client, sigAsset)
+	if err != nil {
+		return nil, fmt.Errorf("fetching keyring.json.sig: %v", err)
+	}
+	var upd keyringUpdate
+	if err := json.Unmarshal(raw, &upd); err != nil {
+		return nil, fmt.Errorf("parsing keyring.json: %v", err)
+	}
+	var sig updateSignature
+	if err := json.Unmarshal(sigRaw, &sig); err != nil {
+		return nil, fmt.Errorf("parsing keyring.json.sig: %v", err)
+	}
+	if err := verifyKeyringUpdate(keys, raw, upd, sig); err != nil {
+		return nil, err
+	}
+	newKeys := applyKeyringUpdate(keys, upd)
+	if err := saveUpdateKeyring(newKeys); err != nil {
+		fmt.Printf("\033[33mWarning: failed to persist keyring update: %v\033[0m\n", err)
+	}
+	return newKeys, nil
+}
+
+// loadMinVersionFloor returns this node's anti-rollback floor, or "" if
+// none has been recorded yet.
+func loadMinVersionFloor() string {
+	data, err := os.ReadFile(updateMinVersionFile)
+	if err != nil {
+		return ""
+	}
+	var v struct {
+		MinVersion string `json:"min_version"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return ""
+	}
+	return v.MinVersion
+}
+
+// saveMinVersionFloor raises this node's anti-rollback floor to
+// minDowngradeVersion, if it's higher than what's already recorded.
+func saveMinVersionFloor(minDowngradeVersion string) {
+	if minDowngradeVersion == "" {
+		return
+	}
+	if floor := loadMinVersionFloor(); floor != "" && !isVersionNewer(minDowngradeVersion, floor) {
+		return
 	}
+	data, _ := json.Marshal(struct {
+		MinVersion string `json:"min_version"`
+	}{MinVersion: minDowngradeVersion})
+	_ = os.WriteFile(updateMinVersionFile, data, 0644)
 }
 
 func isVersionNewer(latest, current string) bool {
@@ -85,89 +283,67 @@ func isVersionNewer(latest, current string) bool {
 	return len(latestParts) > len(currentParts)
 }
 
-func downloadAndInstallUpdate(client *http.Client, release GitHubRelease) {
-	// Determine asset name
-	osName := runtime.GOOS
-	arch := runtime.GOARCH
-	var assetName string
-	if osName == "windows" {
-		assetName = fmt.Sprintf("owonero-%s-%s.zip", osName, arch)
-	} else {
-		assetName = fmt.Sprintf("owonero-%s-%s.zip", osName, arch)
-	}
-
-	var downloadURL string
-	for _, asset := range release.Assets {
-		if asset.Name == assetName {
-			downloadURL = asset.BrowserDownloadURL
-			break
-		}
-	}
-
-	if downloadURL == "" {
-		fmt.Printf("\033[31mNo suitable update found for %s/%s\033[0m\n", osName, arch)
-		return
-	}
-
-	// Download the update
-	resp, err := client.Get(downloadURL)
+// applyUpdate downloads asset, checks it against manifest.SHA256, swaps it
+// in over the running executable (keeping a .backup), and probes the new
+// binary with runUpdateHealthcheck before committing: if the probe doesn't
+// succeed within updateHealthcheckTimeout, the swap is rolled back.
+func applyUpdate(client *http.Client, manifest updateManifest, asset GitHubAsset) {
+	resp, err := client.Get(asset.BrowserDownloadURL)
 	if err != nil {
 		fmt.Printf("\033[31mFailed to download update: %v\033[0m\n", err)
 		return
 	}
 	defer resp.Body.Close()
-
 	if resp.StatusCode != http.StatusOK {
 		fmt.Printf("\033[31mDownload failed: HTTP %d\033[0m\n", resp.StatusCode)
 		return
 	}
 
-	// Get current executable path
 	execPath, err := os.Executable()
 	if err != nil {
 		fmt.Printf("\033[31mFailed to get executable path: %v\033[0m\n", err)
 		return
 	}
 
-	// Create backup
-	backupPath := execPath + ".backup"
-	if err := os.Rename(execPath, backupPath); err != nil {
-		fmt.Printf("\033[31mFailed to create backup: %v\033[0m\n", err)
-		return
-	}
-
-	// Download to temp zip file first
 	tempZipPath := execPath + ".tmp.zip"
 	out, err := os.Create(tempZipPath)
 	if err != nil {
 		fmt.Printf("\033[31mFailed to create temp zip file: %v\033[0m\n", err)
-		os.Rename(backupPath, execPath) // restore
 		return
 	}
-	defer out.Close()
-
-	if _, err := io.Copy(out, resp.Body); err != nil {
-		fmt.Printf("\033[31mFailed to write update zip: %v\033[0m\n", err)
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hasher), resp.Body); err != nil {
+		out.Close()
 		os.Remove(tempZipPath)
-		os.Rename(backupPath, execPath) // restore
+		fmt.Printf("\033[31mFailed to write update zip: %v\033[0m\n", err)
 		return
 	}
 	out.Close()
 
-	// Extract the zip file
-	fmt.Printf("\033[36mExtracting update...\033[0m\n")
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if !strings.EqualFold(sum, manifest.SHA256) {
+		os.Remove(tempZipPath)
+		fmt.Printf("\033[31mUpdate asset sha256 mismatch (got %s, manifest says %s); refusing to install\033[0m\n", sum, manifest.SHA256)
+		return
+	}
+
+	backupPath := execPath + ".backup"
+	if err := os.Rename(execPath, backupPath); err != nil {
+		os.Remove(tempZipPath)
+		fmt.Printf("\033[31mFailed to create backup: %v\033[0m\n", err)
+		return
+	}
+
+	fmt.Println("\033[36mExtracting update...\033[0m")
 	if err := extractZip(tempZipPath, filepath.Dir(execPath)); err != nil {
 		fmt.Printf("\033[31mFailed to extract update: %v\033[0m\n", err)
 		os.Remove(tempZipPath)
 		os.Rename(backupPath, execPath) // restore
 		return
 	}
-
-	// Clean up zip file
 	os.Remove(tempZipPath)
 
-	// Make executable on Unix
-	if osName != "windows" {
+	if runtime.GOOS != "windows" {
 		if err := os.Chmod(execPath, 0755); err != nil {
 			fmt.Printf("\033[31mFailed to make executable: %v\033[0m\n", err)
 			os.Rename(backupPath, execPath) // restore
@@ -175,13 +351,100 @@ func downloadAndInstallUpdate(client *http.Client, release GitHubRelease) {
 		}
 	}
 
-	// Clean up backup
-	os.Remove(backupPath)
+	fmt.Println("\033[36mProbing new binary before committing to it...\033[0m")
+	if err := runUpdateHealthcheck(execPath); err != nil {
+		fmt.Printf("\033[31mNew binary failed its post-update healthcheck (%v); rolling back\033[0m\n", err)
+		os.Remove(execPath)
+		os.Rename(backupPath, execPath)
+		return
+	}
 
-	fmt.Printf("\033[32mUpdate installed successfully! Please restart the application.\033[0m\n")
+	os.Remove(backupPath)
+	saveMinVersionFloor(manifest.MinDowngradeVersion)
+	fmt.Printf("\033[32mUpdate to %s installed successfully! Please restart the application.\033[0m\n", manifest.Version)
 	os.Exit(0)
 }
 
+// runUpdateHealthcheck spawns execPath as `<execPath> update-healthcheck
+// <port>` and requires it to answer a getheight request on that loopback
+// port within updateHealthcheckTimeout, proving the swapped-in binary can
+// at least start up and answer a basic query before applyUpdate commits to
+// it over the .backup.
+func runUpdateHealthcheck(execPath string) error {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("reserving a probe port: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close() // release it for the probe subprocess to bind; small window but no alternative without a dedicated probe endpoint
+
+	cmd := exec.Command(execPath, updateHealthcheckArg, strconv.Itoa(port))
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting probe process: %v", err)
+	}
+	defer cmd.Process.Kill()
+
+	deadline := time.Now().Add(updateHealthcheckTimeout)
+	var lastErr error
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), 500*time.Millisecond)
+		if err != nil {
+			lastErr = err
+			time.Sleep(250 * time.Millisecond)
+			continue
+		}
+		conn.SetDeadline(time.Now().Add(2 * time.Second))
+		fmt.Fprintln(conn, "getheight")
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		if err == nil && strings.TrimSpace(reply) != "" {
+			return nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no response")
+	}
+	return fmt.Errorf("probe on port %d: %v", port, lastErr)
+}
+
+// runUpdateHealthcheckProbe implements the `update-healthcheck <port>`
+// subcommand runUpdateHealthcheck spawns: it answers a single getheight
+// request against an in-memory genesis-only chain, with no file I/O, just
+// enough to prove the new binary's core command dispatch still works.
+func runUpdateHealthcheckProbe(portArg string) {
+	port, err := strconv.Atoi(portArg)
+	if err != nil {
+		os.Exit(1)
+	}
+	genesis := chain.Block{
+		Index:        0,
+		Timestamp:    "2025-10-11T00:00:00Z",
+		Transactions: []chain.Transaction{chain.NewTransaction("genesis", "network", 0)},
+	}
+	genesis.Hash = chain.CalculateHash(genesis)
+	bc := chain.Blockchain{Chain: []chain.Block{genesis}}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		os.Exit(1)
+	}
+	defer ln.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "getheight" {
+			fmt.Fprintln(conn, len(bc.Chain)-1)
+			return
+		}
+	}
+}
+
 func extractZip(zipPath, destDir string) error {
 	r, err := zip.OpenReader(zipPath)
 	if err != nil {
@@ -224,4 +487,4 @@ func extractZip(zipPath, destDir string) error {
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// updateKeyringFile caches the fully-resolved set of trusted update-signing
+// keys after the last accepted keyring rotation (see applyKeyringUpdate),
+// so a future run doesn't need to re-derive it from the embedded baseline
+// plus every historical rotation.
+const updateKeyringFile = "update_keyring.json"
+
+// updateSigningKey is one Ed25519 key trusted to sign release manifests,
+// named by a short id so a detached signature can say which key signed it
+// without embedding the key itself.
+type updateSigningKey struct {
+	ID        string `json:"id"`
+	PublicKey string `json:"public_key"` // hex
+}
+
+// trustedUpdateKeys are the release-signing keys baked into this binary at
+// build time. A compromised or aging key is retired by shipping a signed
+// keyring update in a release (see applyKeyringUpdate) rather than cutting
+// a new binary for every rotation.
+var trustedUpdateKeys = []updateSigningKey{
+	{ID: "2025-01", PublicKey: "3ce322729f6832f4c050efc45004ff80a17ca855aedc6087346f1abd998806b2"},
+}
+
+// updateSignature is a detached Ed25519 signature over another asset's raw
+// bytes, plus the id of the key that produced it.
+type updateSignature struct {
+	KeyID     string `json:"key_id"`
+	Signature string `json:"signature"` // hex
+}
+
+// keyringUpdate rotates the trusted-key set: AddKeys introduces new signing
+// keys, RevokeIDs retires old ones. Delivered as a release asset
+// (keyring.json) alongside a detached keyring.json.sig, which must verify
+// against a key that is currently trusted and not itself being revoked by
+// this same update -- a compromised key can't revoke itself to smuggle in a
+// replacement no one else ever trusted.
+type keyringUpdate struct {
+	AddKeys   []updateSigningKey `json:"add_keys"`
+	RevokeIDs []string           `json:"revoke_ids"`
+}
+
+// persistedKeyring is the on-disk cache format for updateKeyringFile.
+type persistedKeyring struct {
+	Keys []updateSigningKey `json:"keys"`
+}
+
+// loadUpdateKeyring returns the effective trusted-key set: the cached
+// result of the last accepted rotation, or the embedded baseline if none
+// has ever been accepted.
+func loadUpdateKeyring() []updateSigningKey {
+	data, err := os.ReadFile(updateKeyringFile)
+	if err != nil {
+		return append([]updateSigningKey{}, trustedUpdateKeys...)
+	}
+	var persisted persistedKeyring
+	if err := json.Unmarshal(data, &persisted); err != nil || len(persisted.Keys) == 0 {
+		return append([]updateSigningKey{}, trustedUpdateKeys...)
+	}
+	return persisted.Keys
+}
+
+// saveUpdateKeyring caches keys as the new effective trusted-key set.
+func saveUpdateKeyring(keys []updateSigningKey) error {
+	data, err := json.MarshalIndent(persistedKeyring{Keys: keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(updateKeyringFile, data, 0644)
+}
+
+// applyKeyringUpdate returns keys with upd's AddKeys appended and
+// RevokeIDs removed. Callers must verify upd (see verifyKeyringUpdate)
+// before applying it.
+func applyKeyringUpdate(keys []updateSigningKey, upd keyringUpdate) []updateSigningKey {
+	revoked := make(map[string]bool, len(upd.RevokeIDs))
+	for _, id := range upd.RevokeIDs {
+		revoked[id] = true
+	}
+	out := make([]updateSigningKey, 0, len(keys)+len(upd.AddKeys))
+	for _, k := range keys {
+		if !revoked[k.ID] {
+			out = append(out, k)
+		}
+	}
+	out = append(out, upd.AddKeys...)
+	return out
+}
+
+// verifyKeyringUpdate checks that raw (the exact bytes of keyring.json)
+// carries a valid signature, by sig, from a key in keys -- and that sig's
+// own key isn't among upd.RevokeIDs.
+func verifyKeyringUpdate(keys []updateSigningKey, raw []byte, upd keyringUpdate, sig updateSignature) error {
+	for _, id := range upd.RevokeIDs {
+		if id == sig.KeyID {
+			return fmt.Errorf("keyring update signed by a key it also revokes (%s)", id)
+		}
+	}
+	return verifyDetached(keys, raw, sig)
+}
+
+// verifyDetached checks that sig.Signature is a valid Ed25519 signature by
+// sig.KeyID (looked up in keys) over raw.
+func verifyDetached(keys []updateSigningKey, raw []byte, sig updateSignature) error {
+	var pub ed25519.PublicKey
+	for _, k := range keys {
+		if k.ID == sig.KeyID {
+			decoded, err := hex.DecodeString(k.PublicKey)
+			if err != nil || len(decoded) != ed25519.PublicKeySize {
+				return fmt.Errorf("update key %s has a malformed embedded public key", k.ID)
+			}
+			pub = ed25519.PublicKey(decoded)
+			break
+		}
+	}
+	if pub == nil {
+		return fmt.Errorf("signature references unknown or revoked key id %q", sig.KeyID)
+	}
+	sigBytes, err := hex.DecodeString(sig.Signature)
+	if err != nil {
+		return fmt.Errorf("malformed signature hex: %v", err)
+	}
+	if !ed25519.Verify(pub, raw, sigBytes) {
+		return fmt.Errorf("signature by key %q does not verify", sig.KeyID)
+	}
+	return nil
+}
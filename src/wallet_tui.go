@@ -4,10 +4,14 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
-	"net"
 	"os"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
+	"github.com/tosterlolz/Owonero/src/pkg/p2p"
+	"github.com/tosterlolz/Owonero/src/pkg/wallet"
 )
 
 func clearScreen() {
@@ -34,14 +38,17 @@ func printMenu() {
 	fmt.Printf("\n%sChoose an option (1-7): %s", Bold, Reset)
 }
 
+// getBalanceFromNode asks the node for a plain getbalance (backed by its
+// balance index) instead of the old getwallet full-chain-scan call, the
+// same way every other fast path in this daemon was converted.
 func getBalanceFromNode(nodeAddr, address string) (int, error) {
-	conn, err := net.Dial("tcp", nodeAddr)
+	conn, err := p2p.DialPeer(nodeAddr)
 	if err != nil {
 		return 0, fmt.Errorf("failed to connect to node: %v", err)
 	}
 	defer conn.Close()
 
-	fmt.Fprintln(conn, "getwallet")
+	fmt.Fprintln(conn, "getbalance")
 	fmt.Fprintln(conn, address)
 
 	respReader := bufio.NewReader(conn)
@@ -58,24 +65,82 @@ func getBalanceFromNode(nodeAddr, address string) (int, error) {
 		return 0, fmt.Errorf("node error: %s", resp[6:])
 	}
 
-	if !strings.HasPrefix(resp, "{") {
+	balance, err := strconv.Atoi(resp)
+	if err != nil {
 		return 0, fmt.Errorf("unexpected response format: %s", resp)
 	}
 
-	var walletInfo struct {
-		Address string `json:"address"`
-		Balance int    `json:"balance"`
+	return balance, nil
+}
+
+// parseOutputs parses a comma-separated "addr=amount" list into outputs for
+// a multi-recipient transaction.
+func parseOutputs(s string) ([]chain.TxOutput, error) {
+	if s == "" {
+		return nil, fmt.Errorf("recipient list cannot be empty")
+	}
+	var outputs []chain.TxOutput
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("malformed recipient %q, expected addr=amount", pair)
+		}
+		addr := strings.TrimSpace(parts[0])
+		amount, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || amount <= 0 {
+			return nil, fmt.Errorf("invalid amount for %s: must be a positive number", addr)
+		}
+		outputs = append(outputs, chain.TxOutput{To: addr, Amount: amount})
+	}
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("recipient list cannot be empty")
+	}
+	return outputs, nil
+}
+
+// historyPageSize is how many entries getHistoryFromNode requests per page
+// for menu option 5 -- a node's full history for a busy address could be
+// huge, so the TUI pages through it newest-first instead of dumping it all.
+const historyPageSize = 10
+
+func getHistoryFromNode(nodeAddr, address string, limit, beforeHeight int) ([]HistoryResponseEntry, error) {
+	conn, err := p2p.DialPeer(nodeAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to node: %v", err)
+	}
+	defer conn.Close()
+
+	fmt.Fprintln(conn, "gethistory")
+	reqJson, _ := json.Marshal(HistoryRequest{Address: address, Limit: limit, BeforeHeight: beforeHeight})
+	fmt.Fprintln(conn, string(reqJson))
+
+	respReader := bufio.NewReader(conn)
+	// Skip node greeting line
+	_, _ = respReader.ReadString('\n')
+
+	resp, err := respReader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
 	}
 
-	if err := json.Unmarshal([]byte(resp), &walletInfo); err != nil {
-		return 0, fmt.Errorf("failed to parse wallet info: %v", err)
+	resp = strings.TrimSpace(resp)
+	if strings.HasPrefix(resp, "error:") {
+		return nil, fmt.Errorf("node error: %s", resp[6:])
 	}
 
-	return walletInfo.Balance, nil
+	var entries []HistoryResponseEntry
+	if err := json.Unmarshal([]byte(resp), &entries); err != nil {
+		return nil, fmt.Errorf("unexpected response format: %s", resp)
+	}
+	return entries, nil
 }
 
-func sendTransactionToNode(nodeAddr string, tx *Transaction) error {
-	conn, err := net.Dial("tcp", nodeAddr)
+func sendTransactionToNode(nodeAddr string, tx *chain.Transaction) error {
+	conn, err := p2p.DialPeer(nodeAddr)
 	if err != nil {
 		return fmt.Errorf("failed to connect to node: %v", err)
 	}
@@ -104,7 +169,7 @@ func sendTransactionToNode(nodeAddr string, tx *Transaction) error {
 
 func wallet_main(nodeAddr string) {
 	walletPath := "wallet.json"
-	w, err := loadOrCreateWallet(walletPath)
+	w, err := wallet.LoadOrCreateWallet(walletPath)
 	if err != nil {
 		fmt.Printf("%s%sError loading wallet: %v%s\n", Red, Bold, err, Reset)
 		return
@@ -154,29 +219,31 @@ func wallet_main(nodeAddr string) {
 		case "4":
 			fmt.Printf("\n%s%sSend Transaction%s\n", Blue, Bold, Reset)
 
-			// Get recipient address
-			fmt.Printf("%sRecipient address: %s", Yellow, Reset)
-			recipient, _ := reader.ReadString('\n')
-			recipient = strings.TrimSpace(recipient)
+			// Recipients: one or more "address=amount" pairs, comma-separated,
+			// so a single transaction can pay several people at once.
+			fmt.Printf("%sRecipients (addr=amount[,addr=amount...]): %s", Yellow, Reset)
+			recipientsStr, _ := reader.ReadString('\n')
+			recipientsStr = strings.TrimSpace(recipientsStr)
 
-			if recipient == "" {
-				fmt.Printf("%s%sError: Recipient address cannot be empty%s\n", Red, Bold, Reset)
+			outputs, err := parseOutputs(recipientsStr)
+			if err != nil {
+				fmt.Printf("%s%sError: %v%s\n", Red, Bold, err, Reset)
 				fmt.Printf("\n%sPress Enter to continue...%s", Yellow, Reset)
 				reader.ReadString('\n')
 				continue
 			}
 
-			// Get amount
-			fmt.Printf("%sAmount to send: %s", Yellow, Reset)
-			amountStr, _ := reader.ReadString('\n')
-			amountStr = strings.TrimSpace(amountStr)
-
-			amount, err := strconv.Atoi(amountStr)
-			if err != nil || amount <= 0 {
-				fmt.Printf("%s%sError: Invalid amount. Must be a positive number.%s\n", Red, Bold, Reset)
-				fmt.Printf("\n%sPress Enter to continue...%s", Yellow, Reset)
-				reader.ReadString('\n')
-				continue
+			// Optional change address: if given, any balance left over after
+			// the recipients and fee is swept back to it. Chosen and signed
+			// here, client-side, since a node can never be trusted to pick a
+			// spending destination on the wallet's behalf.
+			fmt.Printf("%sChange address (blank to skip): %s", Yellow, Reset)
+			changeAddr, _ := reader.ReadString('\n')
+			changeAddr = strings.TrimSpace(changeAddr)
+
+			requested := 0
+			for _, o := range outputs {
+				requested += o.Amount
 			}
 
 			// Check balance before proceeding
@@ -188,19 +255,26 @@ func wallet_main(nodeAddr string) {
 				continue
 			}
 
-			if balance < amount {
+			if balance < requested {
 				fmt.Printf("%s%sError: Insufficient balance. You have %d OWON, trying to send %d OWON.%s\n",
-					Red, Bold, balance, amount, Reset)
+					Red, Bold, balance, requested, Reset)
 				fmt.Printf("\n%sPress Enter to continue...%s", Yellow, Reset)
 				reader.ReadString('\n')
 				continue
 			}
 
+			if changeAddr != "" {
+				if leftover := balance - requested; leftover > 0 {
+					outputs = append(outputs, chain.TxOutput{To: changeAddr, Amount: leftover})
+				}
+			}
+
 			// Confirmation
 			fmt.Printf("\n%s%sTransaction Details:%s\n", Cyan, Bold, Reset)
 			fmt.Printf("  From: %s\n", w.Address)
-			fmt.Printf("  To: %s\n", recipient)
-			fmt.Printf("  Amount: %d OWON\n", amount)
+			for _, o := range outputs {
+				fmt.Printf("  To %s: %d OWON\n", o.To, o.Amount)
+			}
 			fmt.Printf("  Fee: 0 OWON\n")
 			fmt.Printf("\n%sConfirm transaction? (y/N): %s", Yellow, Reset)
 
@@ -215,13 +289,14 @@ func wallet_main(nodeAddr string) {
 			}
 
 			// Create and sign transaction
-			tx := &Transaction{
-				From:   w.PubKey,
-				To:     recipient,
-				Amount: amount,
+			tx := &chain.Transaction{
+				From:    w.Address,
+				PubKey:  w.PubKey,
+				Outputs: outputs,
+				Nonce:   time.Now().UnixNano(),
 			}
 
-			err = SignTransaction(tx, w.PrivKey)
+			err = chain.SignTransaction(tx, w.PrivKey)
 			if err != nil {
 				fmt.Printf("%s%sError signing transaction: %v%s\n", Red, Bold, err, Reset)
 				fmt.Printf("\n%sPress Enter to continue...%s", Yellow, Reset)
@@ -243,7 +318,52 @@ func wallet_main(nodeAddr string) {
 
 		case "5":
 			fmt.Printf("\n%s%sTransaction History%s\n", Blue, Bold, Reset)
-			fmt.Printf("%s%sFeature coming soon!%s\n", Yellow, Bold, Reset)
+
+			beforeHeight := 0
+			for {
+				entries, err := getHistoryFromNode(nodeAddr, w.Address, historyPageSize, beforeHeight)
+				if err != nil {
+					fmt.Printf("%s%sError: %v%s\n", Red, Bold, err, Reset)
+					break
+				}
+				if len(entries) == 0 {
+					if beforeHeight == 0 {
+						fmt.Printf("%sNo transactions yet.%s\n", Yellow, Reset)
+					} else {
+						fmt.Printf("%sNo more transactions.%s\n", Yellow, Reset)
+					}
+					break
+				}
+
+				for _, e := range entries {
+					status := fmt.Sprintf("%d confirmations", e.Confirmations)
+					if e.Height < 0 {
+						status = "pending"
+					}
+					deltaStr := fmt.Sprintf("%d", e.Delta)
+					if e.Delta >= 0 {
+						deltaStr = "+" + deltaStr
+					}
+					fmt.Printf("  %s%s%s  %s%s OWON%s  <-> %s  (%s)\n",
+						Cyan, e.TxID[:16], Reset, Green, deltaStr, Reset, e.Counterparty, status)
+				}
+
+				oldest := entries[len(entries)-1].Height
+				if oldest < 0 {
+					// Oldest entry shown is still pending, so there's
+					// nothing confirmed before it to page into.
+					break
+				}
+				beforeHeight = oldest
+
+				fmt.Printf("\n%sShow more? (y/N): %s", Yellow, Reset)
+				more, _ := reader.ReadString('\n')
+				more = strings.TrimSpace(strings.ToLower(more))
+				if more != "y" && more != "yes" {
+					break
+				}
+			}
+
 			fmt.Printf("\n%sPress Enter to continue...%s", Yellow, Reset)
 			reader.ReadString('\n')
 
@@ -4,30 +4,134 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
+	"github.com/tosterlolz/Owonero/src/pkg/p2p"
 )
 
-func startWebStatsServer(bc *Blockchain, port int) {
+// webStatsAuthUser/webStatsAuthPass gate the one mutating endpoint this
+// server exposes (POST /tx) behind HTTP basic auth, set once from the
+// daemon's --web-user/--web-pass flags in main. An empty webStatsAuthUser
+// disables auth, same as the legacy TCP protocol having none at all -- so
+// local/dev use doesn't require standing up credentials.
+var webStatsAuthUser string
+var webStatsAuthPass string
+
+// startWebStatsServer began life as a single /stats endpoint; it now also
+// exposes read-only REST views of wallets, blocks, transactions and peers,
+// plus a basic-auth-guarded POST /tx, so the Fyne wallet (see
+// wallet/rpcclient.go) can talk to a node without downloading and
+// rescanning the whole chain over the legacy TCP protocol.
+func startWebStatsServer(bc *chain.Blockchain, pm *p2p.PeerManager, mp *Mempool, port int, idx *chain.BalanceIndex, hidx *chain.HistoryIndex) {
 	http.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
 		stats := map[string]interface{}{
 			"chain_height":       len(bc.Chain) - 1,
 			"latest_block_hash":  bc.Chain[len(bc.Chain)-1].Hash,
 			"total_transactions": totalTransactions(bc),
-			"active_miners":      getActiveMiners(),
+			"active_miners":      pm.ActiveMinerCount(),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(stats)
 	})
 
+	http.HandleFunc("/wallet/", func(w http.ResponseWriter, r *http.Request) {
+		address := strings.TrimPrefix(r.URL.Path, "/wallet/")
+		if address == "" {
+			http.Error(w, "missing wallet address", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p2p.GetWalletInfo(address, bc))
+	})
+
+	http.HandleFunc("/history/", func(w http.ResponseWriter, r *http.Request) {
+		address := strings.TrimPrefix(r.URL.Path, "/history/")
+		if address == "" {
+			http.Error(w, "missing wallet address", http.StatusBadRequest)
+			return
+		}
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		beforeHeight, _ := strconv.Atoi(r.URL.Query().Get("before_height"))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(historyResponse(bc, hidx, HistoryRequest{
+			Address: address, Limit: limit, BeforeHeight: beforeHeight,
+		}))
+	})
+
+	http.HandleFunc("/block/height/", func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/block/height/"))
+		if err != nil || n < 0 || n >= len(bc.Chain) {
+			http.Error(w, "unknown block height", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(bc.Chain[n])
+	})
+
+	http.HandleFunc("/block/hash/", func(w http.ResponseWriter, r *http.Request) {
+		idx, ok := bc.IndexOfHash(strings.TrimPrefix(r.URL.Path, "/block/hash/"))
+		if !ok {
+			http.Error(w, "unknown block hash", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(bc.Chain[idx])
+	})
+
+	http.HandleFunc("/tx/", func(w http.ResponseWriter, r *http.Request) {
+		hash := strings.TrimPrefix(r.URL.Path, "/tx/")
+		for _, blk := range bc.Chain {
+			for _, tx := range blk.Transactions {
+				if txID(tx) == hash {
+					w.Header().Set("Content-Type", "application/json")
+					json.NewEncoder(w).Encode(tx)
+					return
+				}
+			}
+		}
+		http.Error(w, "unknown transaction", http.StatusNotFound)
+	})
+
+	http.HandleFunc("/peers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pm.GetPeers())
+	})
+
+	http.HandleFunc("/tx", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if webStatsAuthUser != "" {
+			user, pass, ok := r.BasicAuth()
+			if !ok || user != webStatsAuthUser || pass != webStatsAuthPass {
+				w.Header().Set("WWW-Authenticate", `Basic realm="owonero"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		var tx chain.Transaction
+		if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+			http.Error(w, fmt.Sprintf("cannot parse transaction: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := mp.Insert(tx, bc, idx, hidx); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		go gossipTx(pm, tx, "")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"status": "ok", "txid": txID(tx)})
+	})
+
 	fmt.Printf("Web stats server listening on :%d\n", port)
 	http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
 
 }
 
-func getActiveMiners() int {
-	return len(miners)
-}
-
-func totalTransactions(bc *Blockchain) int {
+func totalTransactions(bc *chain.Blockchain) int {
 	total := 0
 	for _, blk := range bc.Chain {
 		total += len(blk.Transactions)
@@ -2,14 +2,10 @@ package main
 
 import (
 	"bufio"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
-	"encoding/base64"
-	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"net"
 	"os"
@@ -21,127 +17,52 @@ import (
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
-)
-
-// Wallet stores address, public and private key (ECDSA)
-type Wallet struct {
-	Address string `json:"address"`
-	PubKey  string `json:"pubkey"`
-	PrivKey string `json:"privkey"`
-}
-
-// Transaction represents a simple transaction
-type Transaction struct {
-	From      string `json:"from"`
-	To        string `json:"to"`
-	Amount    int    `json:"amount"`
-	Signature string `json:"signature"`
-}
-
-// Block structure
-type Block struct {
-	Index        int           `json:"index"`
-	Timestamp    string        `json:"timestamp"`
-	Transactions []Transaction `json:"transactions"`
-	PrevHash     string        `json:"prev_hash"`
-	Hash         string        `json:"hash"`
-	Nonce        int           `json:"nonce"`
-}
-
-// Blockchain - chain of blocks
-type Blockchain struct {
-	Chain []Block `json:"chain"`
-}
 
-// loadOrCreateWallet - if no file exists creates new OWO address...
-func loadOrCreateWallet(path string) (Wallet, error) {
-	var w Wallet
-	if _, err := os.Stat(path); err == nil {
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return Wallet{}, err
-		}
-		if err := json.Unmarshal(data, &w); err != nil {
-			return Wallet{}, err
-		}
-	}
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
+	"github.com/tosterlolz/Owonero/src/pkg/wallet"
+)
 
-	// If wallet is missing address, generate one
-	if w.Address == "" {
-		w.Address = fmt.Sprintf("OWO%016x", time.Now().UnixNano())
+// nodeTLSSkipVerify and nodePinnedCert are set once from CLI flags in main
+// and read by dialNode whenever the wallet talks to a daemon that was
+// started with --tls.
+var nodeTLSEnabled bool
+var nodeTLSSkipVerify bool
+var nodePinnedCert string
+
+// rpcUser/rpcPass are the basic-auth credentials sent with submitTransactionRPC,
+// set once from --rpc-user/--rpc-pass to match whatever --web-user/--web-pass
+// the target daemon was started with.
+var rpcUser string
+var rpcPass string
+
+// dialNode opens a connection to a daemon node, speaking TLS when the
+// wallet was started with --tls and falling back to plain TCP otherwise.
+// syncBlockchainFromNode and the "Send OWO" button both go through this so
+// --tls-skip-verify/--peer-cert apply uniformly.
+func dialNode(addr string) (net.Conn, error) {
+	if !nodeTLSEnabled {
+		return net.Dial("tcp", addr)
 	}
 
-	// If wallet is missing keys, generate new ECDSA key pair
-	if w.PubKey == "" || w.PrivKey == "" {
-		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-		if err != nil {
-			return Wallet{}, fmt.Errorf("failed to generate keys: %v", err)
-		}
-		privBytes, err := x509.MarshalECPrivateKey(priv)
-		if err != nil {
-			return Wallet{}, fmt.Errorf("failed to marshal private key: %v", err)
-		}
-		pubBytes, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	cfg := &tls.Config{InsecureSkipVerify: nodeTLSSkipVerify}
+	if nodePinnedCert != "" {
+		pemBytes, err := os.ReadFile(nodePinnedCert)
 		if err != nil {
-			return Wallet{}, fmt.Errorf("failed to marshal public key: %v", err)
+			return nil, fmt.Errorf("cannot read pinned node cert %s: %v", nodePinnedCert, err)
 		}
-		w.PrivKey = base64.StdEncoding.EncodeToString(privBytes)
-		w.PubKey = base64.StdEncoding.EncodeToString(pubBytes)
-	}
-
-	// Save wallet to file
-	data, _ := json.MarshalIndent(w, "", "  ")
-	if err := os.WriteFile(path, data, 0600); err != nil {
-		return Wallet{}, err
-	}
-	return w, nil
-}
-
-// getBalance - counts wallet balance by scanning blockchain
-func getBalance(w Wallet, bc *Blockchain) int {
-	balance := 0
-	for _, blk := range bc.Chain {
-		for _, tx := range blk.Transactions {
-			if tx.To == w.Address {
-				balance += tx.Amount
-			}
-			if tx.From == w.Address {
-				balance -= tx.Amount
-			}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemBytes) {
+			return nil, fmt.Errorf("no certificates found in %s", nodePinnedCert)
 		}
+		cfg.RootCAs = pool
+		cfg.InsecureSkipVerify = false
 	}
-	return balance
-}
-
-// SignTransaction - podpisuje transakcję kluczem prywatnym (ECDSA)
-
-func SignTransaction(tx *Transaction, privPem string) error {
-	privBytes, err := base64.StdEncoding.DecodeString(privPem)
-	if err != nil {
-		return fmt.Errorf("cannot decode private key base64: %v", err)
-	}
-	priv, err := x509.ParseECPrivateKey(privBytes)
-	if err != nil {
-		return fmt.Errorf("cannot parse private key: %v", err)
-	}
-	// Hashujemy dane transakcji
-	msg := fmt.Sprintf("%s|%s|%d", tx.From, tx.To, tx.Amount)
-	hash := sha256.Sum256([]byte(msg))
-	r, s, err := ecdsa.Sign(rand.Reader, priv, hash[:])
-	if err != nil {
-		return fmt.Errorf("sign error: %v", err)
-	}
-	sigBytes, _ := json.Marshal(struct {
-		R string `json:"r"`
-		S string `json:"s"`
-	}{R: r.Text(16), S: s.Text(16)})
-	tx.Signature = hex.EncodeToString(sigBytes)
-	return nil
+	return tls.Dial("tcp", addr, cfg)
 }
 
 // syncBlockchainFromNode - sync blockchain from daemon node
-func syncBlockchainFromNode(nodeAddr string) (*Blockchain, error) {
-	conn, err := net.Dial("tcp", nodeAddr)
+func syncBlockchainFromNode(nodeAddr string) (*chain.Blockchain, error) {
+	conn, err := dialNode(nodeAddr)
 	if err != nil {
 		return nil, fmt.Errorf("cannot connect to node: %v", err)
 	}
@@ -165,7 +86,7 @@ func syncBlockchainFromNode(nodeAddr string) (*Blockchain, error) {
 		}
 	}
 
-	var bc Blockchain
+	var bc chain.Blockchain
 	if err := json.Unmarshal([]byte(jsonLine), &bc); err != nil {
 		return nil, fmt.Errorf("cannot parse blockchain: %v", err)
 	}
@@ -173,7 +94,23 @@ func syncBlockchainFromNode(nodeAddr string) (*Blockchain, error) {
 	return &bc, nil
 }
 
+// getBalance folds a synced chain into a fresh BalanceIndex (see
+// chain.BalanceIndex) instead of hand-rolling a tx scan, the same
+// credit/debit rule the rest of the daemon uses.
+func getBalance(w wallet.Wallet, bc *chain.Blockchain) int {
+	idx := chain.NewBalanceIndex()
+	idx.Rebuild(bc)
+	return wallet.GetBalance(w, idx)
+}
+
 func main() {
+	flag.BoolVar(&nodeTLSEnabled, "tls", false, "connect to the daemon over TLS")
+	flag.BoolVar(&nodeTLSSkipVerify, "tls-skip-verify", false, "don't verify the node's TLS certificate (insecure, testing only)")
+	flag.StringVar(&nodePinnedCert, "peer-cert", "", "path to the node's certificate to pin instead of trusting the system/self-signed CA")
+	flag.StringVar(&rpcUser, "rpc-user", "", "basic-auth username for the node's web stats RPC (matches its --web-user)")
+	flag.StringVar(&rpcPass, "rpc-pass", "", "basic-auth password for --rpc-user")
+	flag.Parse()
+
 	a := app.New()
 	w := a.NewWindow("Owonero Wallet")
 
@@ -181,15 +118,15 @@ func main() {
 	nodeAddr := "owonero.yabai.buzz:6969"
 
 	// Load or create wallet
-	wallet, err := loadOrCreateWallet(walletPath)
+	myWallet, err := wallet.LoadOrCreateWallet(walletPath)
 	if err != nil {
 		dialog.ShowError(err, w)
 		return
 	}
 
 	// UI Elements
-	addressBtn := widget.NewButton("Address: "+wallet.Address, func() {
-		w.Clipboard().SetContent(wallet.Address)
+	addressBtn := widget.NewButton("Address: "+myWallet.Address, func() {
+		w.Clipboard().SetContent(myWallet.Address)
 		dialog.ShowInformation("Copied", "Wallet address copied to clipboard!", w)
 	})
 	balanceLabel := widget.NewLabel("Balance: Loading...")
@@ -197,6 +134,9 @@ func main() {
 	nodeEntry.SetText(nodeAddr)
 	nodeEntry.SetPlaceHolder("Node address (host:port)")
 
+	webEntry := widget.NewEntry()
+	webEntry.SetPlaceHolder("Web stats RPC address (host:port, optional)")
+
 	recipientEntry := widget.NewEntry()
 	recipientEntry.SetPlaceHolder("Recipient address (OWO... or PEM)")
 	amountEntry := widget.NewEntry()
@@ -218,20 +158,32 @@ func main() {
 		}
 
 		// Prepare transaction
-		tx := Transaction{
-			From:   wallet.PubKey, // wysyłamy PEM klucza publicznego
-			To:     recipient,
-			Amount: amount,
+		tx := chain.Transaction{
+			From:    myWallet.Address,
+			PubKey:  myWallet.PubKey,
+			Outputs: []chain.TxOutput{{To: recipient, Amount: amount}},
+			Nonce:   time.Now().UnixNano(),
 		}
 		// Sign transaction
-		if err := SignTransaction(&tx, wallet.PrivKey); err != nil {
+		if err := chain.SignTransaction(&tx, myWallet.PrivKey); err != nil {
 			dialog.ShowError(fmt.Errorf("sign error: %v", err), w)
 			return
 		}
 
-		// Send transaction to node
+		// Send transaction: prefer the web stats RPC endpoint when a
+		// web address was given, falling back to the legacy TCP sendtx
+		// line protocol otherwise.
 		go func() {
-			conn, err := net.Dial("tcp", node)
+			if webEntry.Text != "" {
+				if err := submitTransactionRPC(webEntry.Text, rpcUser, rpcPass, &tx); err != nil {
+					dialog.ShowError(fmt.Errorf("RPC send failed: %v", err), w)
+					return
+				}
+				dialog.ShowInformation("Transaction sent", "Transaction sent successfully!", w)
+				return
+			}
+
+			conn, err := dialNode(node)
 			if err != nil {
 				dialog.ShowError(fmt.Errorf("cannot connect to node: %v", err), w)
 				return
@@ -252,6 +204,15 @@ func main() {
 	refreshBtn := widget.NewButton("Refresh Balance", func() {
 		balanceLabel.SetText("Balance: Loading...")
 
+		if webEntry.Text != "" {
+			info, err := fetchWalletInfoRPC(webEntry.Text, myWallet.Address)
+			if err == nil {
+				balanceLabel.SetText(fmt.Sprintf("Balance: %d OWO", info.Balance))
+				return
+			}
+			// Fall through to the legacy full-chain sync below.
+		}
+
 		bc, err := syncBlockchainFromNode(nodeEntry.Text)
 		if err != nil {
 			dialog.ShowError(fmt.Errorf("failed to sync: %v", err), w)
@@ -259,7 +220,7 @@ func main() {
 			return
 		}
 
-		balance := getBalance(wallet, bc)
+		balance := getBalance(myWallet, bc)
 		balanceLabel.SetText(fmt.Sprintf("Balance: %d OWO", balance))
 	})
 
@@ -270,6 +231,8 @@ func main() {
 		balanceLabel,
 		widget.NewLabel("Node:"),
 		nodeEntry,
+		widget.NewLabel("Web stats RPC (optional, used instead of Node when set):"),
+		webEntry,
 		widget.NewLabel("Send OWO:"),
 		recipientEntry,
 		amountEntry,
@@ -287,7 +250,7 @@ func main() {
 			balanceLabel.SetText("Balance: Cannot connect to node")
 			return
 		}
-		balance := getBalance(wallet, bc)
+		balance := getBalance(myWallet, bc)
 		balanceLabel.SetText(fmt.Sprintf("Balance: %d OWO", balance))
 	}()
 
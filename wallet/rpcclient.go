@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/tosterlolz/Owonero/src/pkg/chain"
+)
+
+// remoteWalletInfo mirrors the JSON shape of the daemon's WalletInfo (see
+// src/daemon.go), fetched from its web stats REST endpoint instead of
+// downloading and rescanning the whole chain over the legacy TCP protocol.
+type remoteWalletInfo struct {
+	Address       string `json:"address"`
+	TotalReceived int64  `json:"total_received"`
+	TotalSent     int64  `json:"total_sent"`
+	Balance       int64  `json:"balance"`
+}
+
+// fetchWalletInfoRPC calls a daemon's web stats server (GET /wallet/<address>).
+func fetchWalletInfoRPC(webAddr, address string) (*remoteWalletInfo, error) {
+	resp, err := http.Get(fmt.Sprintf("http://%s/wallet/%s", webAddr, address))
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach web stats server: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("web stats server returned %s", resp.Status)
+	}
+	var info remoteWalletInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("cannot parse wallet info: %v", err)
+	}
+	return &info, nil
+}
+
+// submitTransactionRPC posts a signed transaction to a daemon's web stats
+// server (POST /tx), guarded by the same HTTP basic-auth credentials the
+// daemon operator configured with --web-user/--web-pass.
+func submitTransactionRPC(webAddr, user, pass string, tx *chain.Transaction) error {
+	body, err := json.Marshal(tx)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s/tx", webAddr), strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	if user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot reach web stats server: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("web stats server returned %s", resp.Status)
+	}
+	return nil
+}